@@ -0,0 +1,146 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddPolicyWithWindow adds a policy rule to the storage like AddPolicy, which
+// is only active from notBefore until notAfter, for example access that
+// starts with a new job or ends with a contract. A zero time leaves that side
+// of the window open. Inactive rules stay stored but are not loaded; reload
+// the policy when a window opens or closes, see NextActivationChange. It
+// requires WithActivationWindows.
+func (a *Adapter) AddPolicyWithWindow(sec string, ptype string, rule []string, notBefore, notAfter time.Time) error {
+	return a.AddPolicyWithWindowCtx(context.Background(), sec, ptype, rule, notBefore, notAfter)
+}
+
+// AddPolicyWithWindowCtx is like AddPolicyWithWindow but honors the deadline and cancellation of ctx.
+func (a *Adapter) AddPolicyWithWindowCtx(ctx context.Context, sec string, ptype string, rule []string, notBefore, notAfter time.Time) (err error) {
+	ctx, end := a.begin(ctx, "AddPolicyWithWindow")
+	defer func() { err = end(err) }()
+
+	if !a.windows {
+		return errors.New("activation windows are not enabled")
+	}
+	if !notBefore.IsZero() && !notAfter.IsZero() && !notBefore.Before(notAfter) {
+		return errors.New("activation window must end after it starts")
+	}
+	if err := a.validateRule(ptype, rule); err != nil {
+		return err
+	}
+
+	line := a.ruleLine(ptype, rule)
+	line.NotBefore, line.NotAfter = notBefore, notAfter
+	return a.addLine(ctx, line)
+}
+
+// NextActivationChange returns the next time a stored rule becomes active or
+// inactive, at which the policy should be reloaded, or the zero time if no
+// change is scheduled.
+func (a *Adapter) NextActivationChange() (time.Time, error) {
+	return a.NextActivationChangeCtx(context.Background())
+}
+
+// NextActivationChangeCtx is like NextActivationChange but honors the deadline and cancellation of ctx.
+func (a *Adapter) NextActivationChangeCtx(ctx context.Context) (next time.Time, err error) {
+	ctx, end := a.begin(ctx, "NextActivationChange")
+	defer func() { err = end(err) }()
+
+	if !a.windows {
+		return time.Time{}, errors.New("activation windows are not enabled")
+	}
+
+	now := time.Now()
+	for _, field := range []string{a.schema.NotBefore, a.schema.NotAfter} {
+		opts := options.FindOne().
+			SetSort(bson.D{{Key: field, Value: 1}}).
+			SetProjection(bson.M{field: 1})
+		doc, err := a.collection.FindOne(ctx, a.scope(bson.M{field: bson.M{"$gt": now}}), opts).Raw()
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t, ok := doc.Lookup(field).TimeOK(); ok && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next, nil
+}
+
+// active restricts the selector to the rules that are active now, which have
+// neither expired nor are outside their activation window, see WithExpiry
+// and WithActivationWindows.
+func (a *Adapter) active(selector interface{}) interface{} {
+	if !a.expiry && !a.windows {
+		return selector
+	}
+
+	// Missing bounds do not restrict a rule.
+	now := time.Now()
+	conds := bson.A{selector}
+	if a.expiry {
+		conds = append(conds, bson.M{a.schema.ExpiresAt: bson.M{"$not": bson.M{"$lte": now}}})
+	}
+	if a.windows {
+		conds = append(conds,
+			bson.M{a.schema.NotBefore: bson.M{"$not": bson.M{"$gt": now}}},
+			bson.M{a.schema.NotAfter: bson.M{"$not": bson.M{"$lte": now}}})
+	}
+	return bson.M{"$and": conds}
+}
+
+// isActive reports whether the rule of the document is active at now, by the
+// same rules as active.
+func (a *Adapter) isActive(doc bson.Raw, now time.Time) bool {
+	reached := func(field string) bool {
+		t, ok := doc.Lookup(field).TimeOK()
+		return ok && !t.After(now)
+	}
+	if a.expiry && reached(a.schema.ExpiresAt) {
+		return false
+	}
+	if a.windows {
+		if t, ok := doc.Lookup(a.schema.NotBefore).TimeOK(); ok && t.After(now) {
+			return false
+		}
+		if reached(a.schema.NotAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// keptTimes returns the time fields SavePolicy keeps for the rules it stores
+// again.
+func (a *Adapter) keptTimes() []string {
+	var fields []string
+	if a.expiry {
+		fields = append(fields, a.schema.ExpiresAt)
+	}
+	if a.windows {
+		fields = append(fields, a.schema.NotBefore, a.schema.NotAfter)
+	}
+	return fields
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAddPolicyWithWindow(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_windows", WithActivationWindows())
+
+	now := time.Now()
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"bob", "data2", "write"}, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"carol", "data3", "read"}, now.Add(2*time.Hour), time.Time{}); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"dave", "data4", "read"}, time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"eve", "data5", "read"}, now, now); err == nil {
+		t.Error("Expected AddPolicyWithWindow() to reject an empty window")
+	}
+
+	// Only the rules active now are loaded.
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	next, err := a.NextActivationChange()
+	if err != nil {
+		t.Fatalf("Expected NextActivationChange() to be successful; got %v", err)
+	}
+	if want := now.Add(time.Hour); next.Sub(want) > time.Second || want.Sub(next) > time.Second {
+		t.Errorf("Expected the next change at %v; got %v", want, next)
+	}
+}
+
+func TestSavePolicyKeepsScheduledRules(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_windows_save", WithActivationWindows())
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"bob", "data2", "write"}, time.Now().Add(time.Hour), time.Time{}); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	// The rule scheduled for later is still stored.
+	n, err := a.collection.CountDocuments(context.Background(), bson.M{"v0": "bob"})
+	if err != nil {
+		t.Fatalf("Expected CountDocuments() to be successful; got %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected the scheduled rule to survive SavePolicy(); got %d documents", n)
+	}
+}
@@ -15,280 +15,1935 @@
 package mongodbadapter
 
 import (
+	"context"
 	"errors"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/casbin/casbin/model"
-	"github.com/casbin/casbin/persist"
-	"gopkg.in/mgo.v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultTimeout bounds connecting to the server and building the indexes.
+const defaultTimeout = 30 * time.Second
+
+// pingTimeout bounds the ping of IsConnected.
+const pingTimeout = 5 * time.Second
+
 // CasbinRule represents a rule in Casbin.
 type CasbinRule struct {
-	PType string
-	V0    string
-	V1    string
-	V2    string
-	V3    string
-	V4    string
-	V5    string
+	PType string `bson:"ptype"`
+	V0    string `bson:"v0"`
+	V1    string `bson:"v1"`
+	V2    string `bson:"v2"`
+	V3    string `bson:"v3"`
+	V4    string `bson:"v4"`
+	V5    string `bson:"v5"`
+
+	// Len is the number of values of the rule, so that empty values are
+	// kept. It is 0 for rules stored by earlier versions.
+	Len int `bson:"len,omitempty"`
+	// Rest holds the values after V5 of longer rules, which are stored in
+	// the additional value fields or the array of the schema, see Schema.
+	Rest []string `bson:"-"`
+
+	// Tenant scopes the rule to a tenant, see WithTenant.
+	Tenant string `bson:"tenant,omitempty"`
+	// Meta holds the labels stored with a new rule, see AddPolicyWithMeta.
+	Meta map[string]string `bson:"-"`
+	// ExpiresAt is the time a new rule expires, see AddPolicyWithTTL.
+	ExpiresAt time.Time `bson:"-"`
+	// NotBefore and NotAfter bound the time a new rule is active, see
+	// AddPolicyWithWindow.
+	NotBefore time.Time `bson:"-"`
+	NotAfter  time.Time `bson:"-"`
+}
+
+// Adapter represents the MongoDB adapter for policy storage.
+type Adapter struct {
+	// The connection is shared with the views of the adapter, see WithTenant.
+	*connection
+
+	url           string
+	ownsClient    bool
+	clientOptions []*options.ClientOptions
+	filtered      bool
+	filter        interface{}
+	// unloaded is set while nothing has been loaded into a filtered adapter.
+	unloaded      bool
+	filterMu      *sync.RWMutex
+	filteredSave  bool
+	transactions  bool
+	timestamps    bool
+	softDelete    bool
+	ruleHash      bool
+	metadata      bool
+	expiry        bool
+	windows       bool
+	verifySave    bool
+	snapshotLoads bool
+	keepHistory   bool
+	historyName   string
+	keepAudit     bool
+	auditName     string
+	auditSize     int64
+	batchSize     int32
+	allowDiskUse  bool
+	retryAttempts int
+	retryBackoff  time.Duration
+	metrics       Metrics
+	logger        Logger
+	tracer        trace.Tracer
+	cache         *policyCache
+	insertBatch   int
+	insertWorkers int
+	limiter       *rateLimiter
+	breaker       *circuitBreaker
+	slowThreshold time.Duration
+	duplicates    DuplicateMode
+	tenant        string
+	compat        compatibility
+	parent        *Adapter
+	closeOnce     *sync.Once
+	closeErr      error
+
+	// Consistency settings of the policy collection, see WithReadConcern,
+	// WithWriteConcern and WithReadPreference.
+	readConcern  *readconcern.ReadConcern
+	writeConcern *writeconcern.WriteConcern
+	readPref     *readpref.ReadPref
+
+	// loadReadPref, if set, is the read preference of loading the policy,
+	// see WithSecondaryLoads.
+	loadReadPref *readpref.ReadPref
+
+	// Index configuration, see WithFieldIndexes, WithPartialIndexes,
+	// WithIndexes, WithCompoundIndex and WithIndexCreation.
+	fieldIndexes   []string
+	partialIndexes bool
+	indexes        []mongo.IndexModel
+	compoundIndex  bool
+	uniqueIndex    bool
+	indexCreation  IndexCreation
+
+	// shardKey are the fields the collection is sharded on, see WithShardKey.
+	shardKey []string
+	// collation is used to compare rule values, see WithCollation.
+	collation *options.Collation
+
+	// lockHolder identifies the adapter as the holder of save locks, and
+	// saveLockTTL is the duration of the lock taken by SavePolicy, see
+	// AcquireSaveLock and WithSaveLock.
+	lockHolder  string
+	saveLockTTL time.Duration
+
+	// dryRunReport receives the changes destructive operations would make,
+	// see WithDryRun.
+	dryRunReport func(*DryRun)
+
+	// hooks are called around every change, see WithHooks.
+	hooks []Hooks
+
+	// encryptor encrypts the values at the encrypted positions, see
+	// WithEncryption.
+	encryptor Encryptor
+	encrypted map[int]bool
+
+	// Time limits of loading, saving and changing single rules, see
+	// WithLoadTimeout, WithSaveTimeout and WithMutationTimeout.
+	loadTimeout     time.Duration
+	saveTimeout     time.Duration
+	mutationTimeout time.Duration
+
+	// validation is the model rules are checked against before they are
+	// stored, see WithValidation.
+	validation model.Model
+
+	// schema is the document layout of the rules, see WithSchema, and
+	// serializer customizes it, see WithSerializer.
+	schema     Schema
+	serializer Serializer
+
+	// normalizers rewrite rule values before they are stored or matched,
+	// see WithNormalization.
+	normalizers []Normalizer
+
+	// migrations evolve the documents of the policy collection, see
+	// WithMigrations.
+	migrations []Migration
+
+	// incrementalSave makes SavePolicy write only the difference to the
+	// stored rules, see WithIncrementalSave.
+	incrementalSave bool
+
+	// snapshotFile is the file the rules of the last full load are kept in,
+	// see WithSnapshotFile. online is closed once an adapter started from
+	// the snapshot reaches the server, and reconnecting stops its attempts
+	// when the adapter is closed first.
+	snapshotFile string
+	online       chan struct{}
+	reconnecting chan struct{}
 }
 
-// adapter represents the MongoDB adapter for policy storage.
-type adapter struct {
-	url        string
-	session    *mgo.Session
-	collection *mgo.Collection
-	filtered   bool
+// connection is the client and the collections an adapter works with. An
+// adapter shares it with its views, so that they follow it to a new client or
+// collection, see RefreshCredentials and SwitchCollection.
+type connection struct {
+	databaseName   string
+	collectionName string
+	client         *mongo.Client
+	collection     *mongo.Collection
+	// loads is the policy collection loads read from, see
+	// WithSecondaryLoads.
+	loads    *mongo.Collection
+	history  *mongo.Collection
+	auditLog *mongo.Collection
+
+	// credential replaces the credential of the URL, see WithCredential and
+	// RefreshCredentials.
+	credential *options.Credential
+	// connMu is held for reading by every operation, and for writing while
+	// the adapter switches to a new client or collection, see
+	// RefreshCredentials and SwitchCollection.
+	connMu *sync.RWMutex
+	// tenantRules tells whether the collection is known to hold rules of
+	// tenants, see checkUnscoped. It is accessed atomically.
+	tenantRules *int32
 }
 
-// finalizer is the destructor for adapter.
-func finalizer(a *adapter) {
-	a.close()
+// The states of connection.tenantRules.
+const (
+	tenantRulesUnknown int32 = iota
+	tenantRulesNone
+	tenantRulesFound
+)
+
+// Adapter implements the optional adapter interfaces of casbin, so that the
+// enforcer stores single changes rather than saving the whole policy.
+var (
+	_ persist.BatchAdapter     = (*Adapter)(nil)
+	_ persist.UpdatableAdapter = (*Adapter)(nil)
+	_ persist.FilteredAdapter  = (*Adapter)(nil)
+)
+
+// finalizer is the destructor for Adapter.
+func finalizer(a *Adapter) {
+	_ = a.Close()
 }
 
 // NewAdapter is the constructor for Adapter. If database name is not provided
-// in the Mongo URL, 'casbin' will be used as database name.
-func NewAdapter(url string) persist.Adapter {
-	a := &adapter{url: url}
+// in the Mongo URL or through WithDatabase, 'casbin' will be used as database
+// name. The URL may be a full MongoDB connection string; a bare
+// "host:port/db" form is also accepted. NewAdapter panics if the adapter
+// cannot be initialized; use NewAdapterWithError to handle such failures.
+func NewAdapter(url string, opts ...Option) persist.Adapter {
+	a, err := NewAdapterWithError(url, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAdapterWithError is the constructor for Adapter. Behavior is otherwise
+// identical to the NewAdapter function, except that an invalid URL or an
+// unreachable server is reported as an error instead of a panic.
+func NewAdapterWithError(url string, opts ...Option) (*Adapter, error) {
+	a, err := newAdapter(opts)
+	if err != nil {
+		return nil, err
+	}
+	a.url = url
 
 	// Open the DB, create it if not existed.
-	a.open()
+	if err := a.open(); err != nil {
+		err = classify(err)
+		if a.snapshotFile == "" || !errors.Is(err, ErrNotConnected) {
+			return nil, err
+		}
+		// Start from the snapshot of the last load instead.
+		if err := a.openOffline(err); err != nil {
+			return nil, err
+		}
+	}
 
 	// Call the destructor when the object is released.
 	runtime.SetFinalizer(a, finalizer)
 
-	return a
+	return a, nil
 }
 
-// NewFilteredAdapter is the constructor for FilteredAdapter. Behavior is
-// otherwise indentical to the NewAdapter function.
-func NewFilteredAdapter(url string) persist.FilteredAdapter {
-	// The adapter already supports the new interface, it just needs to be retyped.
-	return NewAdapter(url).(*adapter)
-}
+// NewAdapterWithClient is the constructor for Adapter that reuses an existing
+// client instead of dialing a new one, sharing its connection pool, TLS and
+// authentication settings. If databaseName is empty, 'casbin' will be used.
+// The adapter never disconnects the client; its lifetime stays with the
+// caller.
+func NewAdapterWithClient(client *mongo.Client, databaseName string, opts ...Option) (*Adapter, error) {
+	if client == nil {
+		return nil, errors.New("client must not be nil")
+	}
 
-func (a *adapter) open() {
-	dI, err := mgo.ParseURL(a.url)
+	a, err := newAdapter(opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	a.client = client
 
-	// FailFast will cause connection and query attempts to fail faster when
-	// the server is unavailable, instead of retrying until the configured
-	// timeout period. Note that an unavailable server may silently drop
-	// packets instead of rejecting them, in which case it's impossible to
-	// distinguish it from a slow server, so the timeout stays relevant.
-	dI.FailFast = true
+	// A database set through WithDatabase takes precedence.
+	if a.databaseName == "" {
+		a.databaseName = databaseName
+	}
+	if a.databaseName == "" {
+		a.databaseName = defaultDatabaseName
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	if err := a.init(ctx); err != nil {
+		return nil, classify(err)
+	}
+	return a, nil
+}
 
-	if dI.Database == "" {
-		dI.Database = "casbin"
+// newAdapter returns an unconnected adapter with the options applied.
+func newAdapter(opts []Option) (*Adapter, error) {
+	a := &Adapter{
+		connection: &connection{
+			collectionName: defaultCollectionName,
+			connMu:         new(sync.RWMutex),
+			tenantRules:    new(int32),
+		},
+		fieldIndexes: ruleFields,
+		closeOnce:    new(sync.Once),
+		filterMu:     new(sync.RWMutex),
+		schema:       defaultSchema,
+		tracer:       otel.GetTracerProvider().Tracer(tracerName),
+		lockHolder:   newLockHolder(),
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
 	}
+	return a, nil
+}
+
+// WithTenant returns a view of the adapter scoped to the given tenant. The
+// view shares the connection of a, and follows it to new credentials or
+// another collection, see RefreshCredentials and SwitchCollection, but stamps
+// every rule it writes with the tenant and only reads, saves and removes that
+// tenant's rules. Closing the view leaves the connection open. An empty id
+// returns an unscoped view, which sees the rules of all tenants, but refuses
+// to change rules while the collection holds rules of tenants. The view does
+// not create indexes; the tenant field is only indexed by adapters
+// constructed with the WithTenant option.
+func (a *Adapter) WithTenant(id string) *Adapter {
+	a.filterMu.RLock()
+	view := *a
+	a.filterMu.RUnlock()
+	view.tenant = id
+	view.filtered = false
+	view.filter = nil
+	view.unloaded = false
+	view.filterMu = new(sync.RWMutex)
+	view.ownsClient = false
+	// Keep the owner of the connection, and with it its finalizer, from being
+	// collected while the view is in use.
+	view.parent = a
+	view.closeOnce = new(sync.Once)
+	view.closeErr = nil
+	// The snapshot file holds the rules of all tenants.
+	view.snapshotFile = ""
+	view.reconnecting = nil
+	return &view
+}
 
-	session, err := mgo.DialWithInfo(dI)
+// NewFilteredAdapter is the constructor for FilteredAdapter. Behavior is
+// otherwise indentical to the NewAdapter function, except that the adapter
+// starts out filtered with nothing loaded: IsFiltered reports true, so
+// NewEnforcer skips loading the whole policy, and SavePolicy is refused until
+// the policy is loaded in full. Load the rules needed with the enforcer's
+// LoadFilteredPolicy.
+func NewFilteredAdapter(url string, opts ...Option) persist.FilteredAdapter {
+	a, err := NewFilteredAdapterWithError(url, opts...)
 	if err != nil {
 		panic(err)
 	}
+	return a
+}
 
-	db := session.DB(dI.Database)
-	collection := db.C("casbin_rule")
+// NewFilteredAdapterWithError is like NewFilteredAdapter, except that an
+// invalid URL or an unreachable server is reported as an error instead of a
+// panic.
+func NewFilteredAdapterWithError(url string, opts ...Option) (*Adapter, error) {
+	a, err := NewAdapterWithError(url, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// A selector matching no document: with WithFilteredSave, saving before
+	// any load only adds rules.
+	a.setFilter(bson.M{"_id": bson.M{"$in": bson.A{}}}, true)
+	a.unloaded = true
+	return a, nil
+}
 
-	a.session = session
-	a.collection = collection
+// connectionString turns the URL given to the constructors into a MongoDB
+// connection string. Full connection strings are passed on as they are, with
+// all their options, and a bare "host:port/db" form gets the mongodb://
+// scheme.
+func connectionString(url string) string {
+	lower := strings.ToLower(url)
+	if strings.HasPrefix(lower, "mongodb://") || strings.HasPrefix(lower, "mongodb+srv://") {
+		return url
+	}
+	return "mongodb://" + url
+}
 
-	indexes := []string{"ptype", "v0", "v1", "v2", "v3", "v4", "v5"}
-	for _, k := range indexes {
-		if err := a.collection.EnsureIndexKey(k); err != nil {
-			panic(err)
-		}
+func (a *Adapter) open() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	client, err := a.dial(ctx, a.credential)
+	if err != nil {
+		return err
+	}
+
+	a.client = client
+	a.ownsClient = true
+
+	if err := a.init(ctx); err != nil {
+		_ = client.Disconnect(context.Background())
+		return err
 	}
+	return nil
 }
 
-func (a *adapter) close() {
-	a.session.Close()
+// dial connects a new client to the server of the URL and pings it. If cred
+// is not nil, it replaces the credential of the URL.
+func (a *Adapter) dial(ctx context.Context, cred *options.Credential) (*mongo.Client, error) {
+	client, err := a.connect(ctx, cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+	return client, nil
 }
 
-func (a *adapter) dropTable() error {
-	err := a.collection.DropCollection()
+// connect creates a new client for the server of the URL, without waiting for
+// the server to answer.
+func (a *Adapter) connect(ctx context.Context, cred *options.Credential) (*mongo.Client, error) {
+	url := connectionString(a.url)
+
+	cs, err := connstring.ParseAndValidate(url)
 	if err != nil {
-		if err.Error() != "ns not found" {
+		return nil, err
+	}
+
+	if a.databaseName == "" {
+		a.databaseName = cs.Database
+	}
+	if a.databaseName == "" {
+		a.databaseName = defaultDatabaseName
+	}
+
+	// The driver connects lazily, so bound server selection and ping the
+	// server up front. This makes an unavailable server fail the constructor
+	// instead of the first query. Note that an unavailable server may silently
+	// drop packets instead of rejecting them, in which case it's impossible to
+	// distinguish it from a slow server, so the timeout stays relevant.
+	clientOptions := options.Client().ApplyURI(url).SetServerSelectionTimeout(defaultTimeout)
+
+	// Retry a failed write once on replica sets and sharded clusters, unless
+	// the URL says otherwise.
+	if !cs.RetryWritesSet {
+		clientOptions.SetRetryWrites(true)
+	}
+
+	// Options set through the constructor take precedence over the URL.
+	opts := append([]*options.ClientOptions{clientOptions}, a.clientOptions...)
+	if cred != nil {
+		opts = append(opts, options.Client().SetAuth(*cred))
+	}
+	return mongo.Connect(ctx, opts...)
+}
+
+// init selects the policy collection and makes sure it is indexed.
+func (a *Adapter) init(ctx context.Context) error {
+	a.selectCollections()
+	return a.prepare(ctx)
+}
+
+// prepare runs the migrations, creates the audit log, migrates the rules to
+// the schema and creates the indexes of the selected collections, as far as
+// the options ask for it.
+func (a *Adapter) prepare(ctx context.Context) error {
+	if len(a.migrations) > 0 {
+		// Migrations may take longer than connecting.
+		if err := a.migrateSchema(context.Background()); err != nil {
 			return err
 		}
 	}
-	return nil
-}
 
-func loadPolicyLine(line CasbinRule, model model.Model) {
-	key := line.PType
-	sec := key[:1]
+	if a.keepAudit {
+		if err := a.createAuditLog(ctx); err != nil {
+			return err
+		}
+	}
 
-	tokens := []string{}
-	if line.V0 != "" {
-		tokens = append(tokens, line.V0)
-	} else {
-		goto LineEnd
+	if a.schema.Array != "" {
+		if err := a.migrateToArray(ctx); err != nil {
+			return err
+		}
 	}
 
-	if line.V1 != "" {
-		tokens = append(tokens, line.V1)
-	} else {
-		goto LineEnd
+	if a.ruleHash {
+		if err := a.hashRules(ctx); err != nil {
+			return err
+		}
 	}
 
-	if line.V2 != "" {
-		tokens = append(tokens, line.V2)
-	} else {
-		goto LineEnd
+	switch a.indexCreation {
+	case IndexCreationDisabled:
+		return nil
+	case IndexCreationBestEffort:
+		if err := a.ensureIndexes(ctx); err != nil && !isUnauthorized(err) {
+			return err
+		}
+		return nil
+	default:
+		return a.ensureIndexes(ctx)
 	}
+}
 
-	if line.V3 != "" {
-		tokens = append(tokens, line.V3)
-	} else {
-		goto LineEnd
+// selectCollections points the collection handles of the adapter at its
+// database on the current client.
+func (a *Adapter) selectCollections() {
+	db := a.client.Database(a.databaseName)
+	a.collection = db.Collection(a.collectionName, a.collectionOptions())
+	a.loads = a.collection
+	if a.loadReadPref != nil {
+		a.loads = db.Collection(a.collectionName, a.collectionOptions().SetReadPreference(a.loadReadPref))
 	}
 
-	if line.V4 != "" {
-		tokens = append(tokens, line.V4)
-	} else {
-		goto LineEnd
+	if a.keepHistory {
+		name := a.historyName
+		if name == "" {
+			name = a.collectionName + "_history"
+		}
+		a.history = db.Collection(name, a.collectionOptions())
 	}
 
-	if line.V5 != "" {
-		tokens = append(tokens, line.V5)
-	} else {
-		goto LineEnd
+	if a.keepAudit {
+		name := a.auditName
+		if name == "" {
+			name = a.collectionName + "_audit"
+		}
+		a.auditLog = db.Collection(name, a.collectionOptions())
 	}
+}
 
-LineEnd:
-	model[sec][key].Policy = append(model[sec][key].Policy, tokens)
+// ensureIndexes creates the indexes of the policy collection and, if the
+// adapter keeps one, of the history.
+func (a *Adapter) ensureIndexes(ctx context.Context) error {
+	if err := a.createIndexes(ctx, a.collection); err != nil {
+		return err
+	}
+	if a.history != nil {
+		return a.createHistoryIndexes(ctx)
+	}
+	return nil
 }
 
-// LoadPolicy loads policy from database.
-func (a *adapter) LoadPolicy(model model.Model) error {
-	return a.LoadFilteredPolicy(model, nil)
+// collectionOptions returns the options for the collections used by the
+// adapter.
+func (a *Adapter) collectionOptions() *options.CollectionOptions {
+	opts := options.Collection()
+	if a.readConcern != nil {
+		opts.SetReadConcern(a.readConcern)
+	}
+	if a.writeConcern != nil {
+		opts.SetWriteConcern(a.writeConcern)
+	}
+	if a.readPref != nil {
+		opts.SetReadPreference(a.readPref)
+	}
+	return opts
 }
 
-// LoadFilteredPolicy loads matching policy lines from database. If not nil,
-// the filter must be a valid MongoDB selector.
-func (a *adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
-	if filter == nil {
-		a.filtered = false
-	} else {
-		a.filtered = true
+// withTransaction runs fn in a multi-document transaction if the adapter was
+// created with WithTransactions, and directly otherwise. The transaction is
+// committed if fn succeeds and aborted if it fails; transient errors are
+// retried by the driver, so fn may run more than once.
+func (a *Adapter) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Transactions do not nest; fn joins the one in progress, if any.
+	if !a.transactions || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
 	}
-	line := CasbinRule{}
-	iter := a.collection.Find(filter).Iter()
-	for iter.Next(&line) {
-		loadPolicyLine(line, model)
+
+	session, err := a.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// withSnapshot runs fn in a snapshot session if loads are to see the rules
+// as of a single point in time, see WithSnapshotLoads.
+func (a *Adapter) withSnapshot(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !a.snapshotLoads || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
 	}
 
-	return iter.Close()
+	opts := options.Session().SetSnapshot(true)
+	return a.client.UseSessionWithOptions(ctx, opts, func(sc mongo.SessionContext) error {
+		return fn(sc)
+	})
 }
 
-// IsFiltered returns true if the loaded policy has been filtered.
-func (a *adapter) IsFiltered() bool {
-	return a.filtered
+// isUnauthorized reports whether the server rejected a command because the
+// user lacks the privileges for it.
+func isUnauthorized(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 13
 }
 
-func savePolicyLine(ptype string, rule []string) CasbinRule {
-	line := CasbinRule{
-		PType: ptype,
+// createIndexes creates the indexes used by the adapter's queries.
+func (a *Adapter) createIndexes(ctx context.Context, collection *mongo.Collection) error {
+	models := make([]mongo.IndexModel, 0, len(a.fieldIndexes)+len(a.indexes)+1)
+	for _, k := range a.fieldIndexes {
+		field := a.schema.field(k)
+		model := mongo.IndexModel{Keys: bson.D{{Key: field, Value: 1}}}
+		if a.partialIndexes && k != "ptype" && a.compat != compatCosmosDB {
+			// Rules that leave the field empty are not indexed.
+			model.Options = options.Index().SetPartialFilterExpression(bson.M{field: bson.M{"$gt": ""}})
+		}
+		models = append(models, model)
 	}
 
-	if len(rule) > 0 {
-		line.V0 = rule[0]
+	if a.tenant != "" {
+		models = append(models, mongo.IndexModel{Keys: bson.D{{Key: a.schema.Tenant, Value: 1}}})
 	}
-	if len(rule) > 1 {
-		line.V1 = rule[1]
+
+	if a.timestamps {
+		models = append(models, mongo.IndexModel{Keys: bson.D{{Key: a.schema.UpdatedAt, Value: 1}}})
 	}
-	if len(rule) > 2 {
-		line.V2 = rule[2]
+
+	if a.expiry {
+		// The server removes rules once their expiry time has passed.
+		models = append(models, mongo.IndexModel{
+			Keys:    bson.D{{Key: a.schema.ExpiresAt, Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
 	}
-	if len(rule) > 3 {
-		line.V3 = rule[3]
+
+	if a.ruleHash {
+		// The hash index serves exact rule lookups in place of the compound
+		// index.
+		keys := bson.D{}
+		for _, k := range a.shardKey {
+			keys = append(keys, bson.E{Key: a.schema.field(k), Value: 1})
+		}
+		if a.tenant != "" && !a.inShardKey("tenant") {
+			keys = append(keys, bson.E{Key: a.schema.Tenant, Value: 1})
+		}
+		keys = append(keys, bson.E{Key: a.schema.Hash, Value: 1})
+		if a.softDelete {
+			keys = append(keys, bson.E{Key: a.schema.DeletedAt, Value: 1})
+		}
+		models = append(models, mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetUnique(true),
+		})
+	} else if a.compoundIndex {
+		// A unique index of a sharded collection must start with the shard key.
+		fields := append([]string{}, a.shardKey...)
+		if a.tenant != "" {
+			// Each tenant may store the same rule.
+			fields = append(fields, "tenant")
+		}
+		fields = append(fields, a.schema.ruleFields()...)
+
+		keys := make(bson.D, 0, len(fields)+1)
+		seen := map[string]bool{}
+		for _, k := range fields {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, bson.E{Key: a.schema.field(k), Value: 1})
+			}
+		}
+		if a.softDelete {
+			// A deleted rule may be added again.
+			keys = append(keys, bson.E{Key: a.schema.DeletedAt, Value: 1})
+		}
+		models = append(models, mongo.IndexModel{
+			Keys:    keys,
+			Options: options.Index().SetUnique(a.uniqueIndex),
+		})
 	}
-	if len(rule) > 4 {
-		line.V4 = rule[4]
+
+	models = append(models, a.indexes...)
+
+	if len(models) == 0 {
+		return nil
 	}
-	if len(rule) > 5 {
-		line.V5 = rule[5]
+	if a.collation != nil {
+		// Queries only use indexes of the same collation.
+		for i := range models {
+			if models[i].Options == nil {
+				models[i].Options = options.Index()
+			}
+			models[i].Options.SetCollation(a.collation)
+		}
 	}
+	a.debug("creating indexes", "collection", collection.Name(), "count", len(models))
+	if a.compat != compatMongoDB {
+		return a.createIndexesSeparately(ctx, collection, models)
+	}
+	_, err := collection.Indexes().CreateMany(ctx, models)
+	return err
+}
 
-	return line
+// Close disconnects the adapter from the server. It is safe to call Close
+// more than once; later calls return the result of the first one. Close
+// leaves a client passed to NewAdapterWithClient connected, as it belongs to
+// the caller.
+func (a *Adapter) Close() error {
+	a.closeOnce.Do(func() {
+		// The finalizer has nothing left to do.
+		runtime.SetFinalizer(a, nil)
+
+		if a.reconnecting != nil {
+			close(a.reconnecting)
+		}
+		if a.ownsClient {
+			a.closeErr = a.client.Disconnect(context.Background())
+		}
+	})
+	return a.closeErr
 }
 
-// SavePolicy saves policy to database.
-func (a *adapter) SavePolicy(model model.Model) error {
-	if a.filtered {
-		return errors.New("cannot save a filtered policy")
+// Ping checks that the server is reachable, for example for a readiness
+// probe. It uses the read preference of the adapter, see WithReadPreference.
+func (a *Adapter) Ping(ctx context.Context) error {
+	return a.client.Ping(ctx, a.readPref)
+}
+
+// IsConnected reports whether the server answers a ping within a few seconds.
+// It returns false once the adapter has been closed.
+func (a *Adapter) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	return a.Ping(ctx) == nil
+}
+
+func (a *Adapter) dropTable(ctx context.Context) error {
+	if a.dryRunReport != nil {
+		return a.dryRunDrop(ctx)
 	}
-	if err := a.dropTable(); err != nil {
-		return err
+	// Dropping a collection that does not exist is not an error in the driver.
+	return a.collection.Drop(ctx)
+}
+
+// toStringPolicy returns the rule values of the line. Lines stored without
+// their length drop trailing empty values, as those cannot be told from
+// missing ones.
+func (line CasbinRule) toStringPolicy() []string {
+	values := append([]string{line.V0, line.V1, line.V2, line.V3, line.V4, line.V5}, line.Rest...)
+	if line.Len > 0 && line.Len <= len(values) {
+		return values[:line.Len]
+	}
+
+	n := len(values)
+	for n > 0 && values[n-1] == "" {
+		n--
+	}
+	return values[:n]
+}
+
+// key identifies the rule of the line, for use as a map key.
+func (line CasbinRule) key() string {
+	return strings.Join(append([]string{line.Tenant, line.PType}, line.toStringPolicy()...), "\x00")
+}
+
+// loadPolicyLine adds the rule to the model. Rules of a policy type the model
+// does not define are skipped, so one collection may hold the rules of
+// several models. Rules the model holds already are skipped as well, as by
+// persist.LoadPolicyArray.
+func loadPolicyLine(line CasbinRule, m model.Model) {
+	ast := findAssertion(m, line.PType)
+	if ast == nil {
+		return
 	}
 
-	var lines []interface{}
+	rule := line.toStringPolicy()
+	key := strings.Join(rule, model.DefaultSep)
+	if ast.PolicyMap == nil {
+		ast.PolicyMap = map[string]int{}
+	}
+	if _, ok := ast.PolicyMap[key]; ok {
+		return
+	}
+	ast.Policy = append(ast.Policy, rule)
+	ast.PolicyMap[key] = len(ast.Policy) - 1
+}
+
+// findAssertion returns the assertion of the model for the policy type, or
+// nil if the model does not define it. A policy type usually starts with the
+// name of its section, such as "p2" in section "p", but any section is
+// searched.
+func findAssertion(m model.Model, ptype string) *model.Assertion {
+	sec, ok := findSection(m, ptype)
+	if !ok {
+		return nil
+	}
+	return m[sec][ptype]
+}
 
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			lines = append(lines, &line)
+// findSection returns the name of the section of the model that defines the
+// policy type, see findAssertion.
+func findSection(m model.Model, ptype string) (string, bool) {
+	if ptype == "" {
+		return "", false
+	}
+	if _, ok := m[ptype[:1]][ptype]; ok {
+		return ptype[:1], true
+	}
+	for name, sec := range m {
+		if _, ok := sec[ptype]; ok {
+			return name, true
 		}
 	}
+	return "", false
+}
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			line := savePolicyLine(ptype, rule)
-			lines = append(lines, &line)
+// policyTypes returns the policy types of every section of the model that
+// holds rules, in a stable order.
+func policyTypes(m model.Model) []string {
+	var ptypes []string
+	for _, sec := range m {
+		for ptype, ast := range sec {
+			if len(ast.Policy) > 0 {
+				ptypes = append(ptypes, ptype)
+			}
 		}
 	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
+// LoadPolicy loads policy from database.
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyCtx(context.Background(), model)
+}
 
-	return a.collection.Insert(lines...)
+// LoadPolicyCtx is like LoadPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	return a.LoadFilteredPolicyCtx(ctx, model, nil)
 }
 
-// AddPolicy adds a policy rule to the storage.
-func (a *adapter) AddPolicy(sec string, ptype string, rule []string) error {
-	line := savePolicyLine(ptype, rule)
-	return a.collection.Insert(line)
+// LoadFilteredPolicy loads matching policy lines from database. If not nil,
+// the filter must be either a Filter (or *Filter) or a valid MongoDB selector.
+func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	return a.LoadFilteredPolicyCtx(context.Background(), model, filter)
 }
 
-// RemovePolicy removes a policy rule from the storage.
-func (a *adapter) RemovePolicy(sec string, ptype string, rule []string) error {
-	line := savePolicyLine(ptype, rule)
-	if err := a.collection.Remove(line); err != nil {
-		switch err {
-		case mgo.ErrNotFound:
+// LoadFilteredPolicyCtx is like LoadFilteredPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) LoadFilteredPolicyCtx(ctx context.Context, model model.Model, filter interface{}) (err error) {
+	op := "LoadFilteredPolicy"
+	if filter == nil {
+		op = "LoadPolicy"
+	}
+	ctx, end := a.begin(ctx, op)
+	defer func() { err = end(err) }()
+
+	filtered := true
+	switch f := filter.(type) {
+	case nil:
+		filtered = false
+		filter = a.scope(bson.M{})
+	case Filter:
+		filter = a.scope(f.selector(a))
+	case *Filter:
+		filter = a.scope(f.selector(a))
+	default:
+		if a.tenant != "" || a.softDelete {
+			filter = bson.M{"$and": bson.A{filter, a.scope(bson.M{})}}
+		}
+	}
+	a.setFilter(filter, filtered)
+
+	if !filtered && a.snapshotFile != "" && a.offline() {
+		return a.loadSnapshot(model)
+	}
+	if a.cache != nil && !filtered {
+		return a.loadCached(ctx, model, filter)
+	}
+
+	var lines []CasbinRule
+	snapshot := a.snapshotFile != "" && !filtered
+	rules := 0
+	err = a.withSnapshot(ctx, func(ctx context.Context) error {
+		var err error
+		rules, err = a.forEachLine(ctx, a.loads, filter, func(line CasbinRule) error {
+			loadPolicyLine(line, model)
+			if snapshot {
+				lines = append(lines, line)
+			}
 			return nil
-		default:
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	a.rulesLoaded(op, rules)
+	if snapshot {
+		a.saveSnapshot(lines)
+	}
+	return nil
+}
+
+// setFilter records the selector of the last load, which SavePolicy replaces.
+func (a *Adapter) setFilter(filter interface{}, filtered bool) {
+	a.filterMu.Lock()
+	defer a.filterMu.Unlock()
+	a.filter = filter
+	a.filtered = filtered
+	a.unloaded = false
+}
+
+// loadedFilter returns the selector of the last load, and whether it was
+// filtered.
+func (a *Adapter) loadedFilter() (interface{}, bool) {
+	a.filterMu.RLock()
+	defer a.filterMu.RUnlock()
+	return a.filter, a.filtered
+}
+
+// loadCached loads the policy from the cache, or from the database into the
+// cache if it is stale.
+func (a *Adapter) loadCached(ctx context.Context, model model.Model, filter interface{}) error {
+	lines, generation, ok := a.cache.get(a.tenant)
+	if ok {
+		a.debug("loaded policy from cache", "count", len(lines))
+	} else {
+		var fresh []CasbinRule
+		err := a.withSnapshot(ctx, func(ctx context.Context) error {
+			_, err := a.forEachLine(ctx, a.loads, filter, func(line CasbinRule) error {
+				fresh = append(fresh, line)
+				return nil
+			})
 			return err
+		})
+		if err != nil {
+			return err
+		}
+		a.cache.set(a.tenant, fresh, generation)
+		lines = fresh
+		if a.snapshotFile != "" {
+			a.saveSnapshot(lines)
 		}
 	}
+
+	for _, line := range lines {
+		loadPolicyLine(line, model)
+	}
+	a.rulesLoaded("LoadPolicy", len(lines))
 	return nil
 }
 
-// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
-func (a *adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-	selector := make(map[string]interface{})
-	selector["ptype"] = ptype
+// LoadPolicyStream passes every stored rule to fn, one at a time, without
+// building a model. Only the current batch of rules is held in memory, which
+// suits very large policies; see WithBatchSize. If fn returns an error, the
+// stream stops and LoadPolicyStream returns that error.
+func (a *Adapter) LoadPolicyStream(fn func(ptype string, rule []string) error) error {
+	return a.LoadPolicyStreamCtx(context.Background(), fn)
+}
+
+// LoadPolicyStreamCtx is like LoadPolicyStream but honors the deadline and cancellation of ctx.
+func (a *Adapter) LoadPolicyStreamCtx(ctx context.Context, fn func(ptype string, rule []string) error) (err error) {
+	ctx, end := a.begin(ctx, "LoadPolicyStream")
+	defer func() { err = end(err) }()
+
+	rules := 0
+	err = a.withSnapshot(ctx, func(ctx context.Context) error {
+		var err error
+		rules, err = a.forEachLine(ctx, a.loads, a.scope(bson.M{}), func(line CasbinRule) error {
+			return fn(line.PType, line.toStringPolicy())
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	a.rulesLoaded("LoadPolicyStream", rules)
+	return nil
+}
+
+// forEachLine calls fn for each rule of the collection matching the
+// selector, and returns the number of rules passed to fn. A transient error is
+// retried as long as no rule has been passed to fn yet.
+func (a *Adapter) forEachLine(ctx context.Context, collection *mongo.Collection, selector interface{}, fn func(line CasbinRule) error) (int, error) {
+	selector = a.active(selector)
+	a.debug("finding rules", "collection", a.collectionName, "selector", selector)
+
+	var cursor *mongo.Cursor
+	err := a.retry(ctx, func(ctx context.Context) error {
+		var err error
+		cursor, err = collection.Find(ctx, selector, a.findOptions())
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
 
-	if fieldIndex <= 0 && 0 < fieldIndex+len(fieldValues) {
-		selector["v0"] = fieldValues[0-fieldIndex]
+	n := 0
+	defer func() { observeQuery(ctx, selector, int64(n)) }()
+	for cursor.Next(ctx) {
+		n++
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return n, err
+		}
+		if err := fn(line); err != nil {
+			return n, err
+		}
 	}
-	if fieldIndex <= 1 && 1 < fieldIndex+len(fieldValues) {
-		selector["v1"] = fieldValues[1-fieldIndex]
+
+	return n, cursor.Err()
+}
+
+// findOptions returns the options for reading the rules, see WithBatchSize,
+// WithAllowDiskUse and WithCollation.
+func (a *Adapter) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if a.batchSize > 0 {
+		opts.SetBatchSize(a.batchSize)
 	}
-	if fieldIndex <= 2 && 2 < fieldIndex+len(fieldValues) {
-		selector["v2"] = fieldValues[2-fieldIndex]
+	if a.allowDiskUse {
+		opts.SetAllowDiskUse(true)
 	}
-	if fieldIndex <= 3 && 3 < fieldIndex+len(fieldValues) {
-		selector["v3"] = fieldValues[3-fieldIndex]
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
 	}
-	if fieldIndex <= 4 && 4 < fieldIndex+len(fieldValues) {
-		selector["v4"] = fieldValues[4-fieldIndex]
+	return opts
+}
+
+// deleteOptions returns the options for removing rules, see WithCollation.
+func (a *Adapter) deleteOptions() *options.DeleteOptions {
+	opts := options.Delete()
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
 	}
-	if fieldIndex <= 5 && 5 < fieldIndex+len(fieldValues) {
-		selector["v5"] = fieldValues[5-fieldIndex]
+	return opts
+}
+
+// updateOptions returns the options for modifying rules, see WithCollation.
+func (a *Adapter) updateOptions() *options.UpdateOptions {
+	opts := options.Update()
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
 	}
+	return opts
+}
 
-	_, err := a.collection.RemoveAll(selector)
-	return err
+// IsFiltered returns true if the loaded policy has been filtered. With
+// WithFilteredSave a filtered policy can be saved safely, so IsFiltered
+// returns false to let the enforcer save it, except before the first load of
+// a filtered adapter, to keep NewEnforcer from loading the whole policy.
+func (a *Adapter) IsFiltered() bool {
+	a.filterMu.RLock()
+	defer a.filterMu.RUnlock()
+	return a.filtered && (!a.filteredSave || a.unloaded)
+}
+
+// IsFilteredCtx is like IsFiltered. It exists so the adapter satisfies the
+// context-aware adapter interfaces.
+func (a *Adapter) IsFilteredCtx(ctx context.Context) bool {
+	return a.IsFiltered()
+}
+
+func savePolicyLine(ptype string, rule []string) CasbinRule {
+	line := CasbinRule{
+		PType: ptype,
+		Len:   len(rule),
+	}
+
+	if len(rule) > 0 {
+		line.V0 = rule[0]
+	}
+	if len(rule) > 1 {
+		line.V1 = rule[1]
+	}
+	if len(rule) > 2 {
+		line.V2 = rule[2]
+	}
+	if len(rule) > 3 {
+		line.V3 = rule[3]
+	}
+	if len(rule) > 4 {
+		line.V4 = rule[4]
+	}
+	if len(rule) > 5 {
+		line.V5 = rule[5]
+	}
+	if len(rule) > 6 {
+		line.Rest = append([]string{}, rule[6:]...)
+	}
+
+	return line
+}
+
+// SavePolicy saves policy to database.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	return a.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx is like SavePolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) SavePolicyCtx(ctx context.Context, model model.Model) (err error) {
+	ctx, end := a.begin(ctx, "SavePolicy")
+	defer func() { err = end(err) }()
+
+	selector, filtered := a.loadedFilter()
+	if filtered && !a.filteredSave {
+		return errors.New("cannot save a filtered policy")
+	}
+	if err := a.validateModel(model); err != nil {
+		return err
+	}
+	if err := a.checkUnscoped(ctx, "save"); err != nil {
+		return err
+	}
+
+	if a.saveLockTTL > 0 && a.dryRunReport == nil {
+		release, err := a.lockSave(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	var lines []CasbinRule
+	for _, ptype := range policyTypes(model) {
+		for _, rule := range findAssertion(model, ptype).Policy {
+			lines = append(lines, a.ruleLine(ptype, rule))
+		}
+	}
+
+	// Only the rules that were loaded are replaced, which leaves the rules
+	// outside their activation window alone.
+	if !filtered {
+		selector = a.scope(bson.M{})
+	}
+	selector = a.active(selector)
+	if a.dryRunReport != nil {
+		return a.dryRun(ctx, "SavePolicy", selector, lines)
+	}
+
+	err = a.withHistory(ctx, change{op: "save"}, func(ctx context.Context) error {
+		if a.incrementalSave {
+			return a.saveIncremental(ctx, selector, filtered, lines)
+		}
+		return a.replaceLines(ctx, selector, filtered, lines)
+	})
+	if err != nil || !a.verifySave || filtered {
+		return err
+	}
+	return a.verifyLines(ctx, selector, lines)
+}
+
+// replaceLines replaces the rules matching the selector with lines. If
+// partial is false, the selector must match all the rules of the adapter.
+func (a *Adapter) replaceLines(ctx context.Context, selector interface{}, partial bool, lines []CasbinRule) error {
+	docs := make([]interface{}, 0, len(lines))
+	for _, line := range lines {
+		docs = append(docs, a.document(line))
+	}
+	if a.timestamps || a.metadata || a.expiry || a.windows {
+		if err := a.keepStored(ctx, selector, lines, docs); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case partial:
+		return a.replaceFiltered(ctx, selector, lines, docs)
+	case a.transactions || a.indexCreation != IndexCreationRequired || a.tenant != "" || a.softDelete ||
+		a.expiry || a.windows || a.compat == compatCosmosDB || a.shardKey != nil:
+		// A transaction replaces the documents atomically by itself, and
+		// renaming a collection is not allowed inside one. The staged
+		// collection is indexed by the adapter. When the indexes are managed
+		// by someone else, renaming over the collection would drop them. A
+		// tenant owns only part of the collection, and tombstones and the
+		// rules that are not active now must survive the save, so it cannot
+		// be replaced either. Cosmos DB cannot rename collections at all, and
+		// a sharded collection cannot be the target of a rename.
+		return a.replaceDocuments(ctx, selector, docs)
+	case len(docs) == 0:
+		// There is nothing to stage for an empty policy.
+		return a.deleteMany(ctx, bson.M{})
+	default:
+		return a.replaceCollection(ctx, docs)
+	}
+}
+
+// keepStored carries the timestamps, metadata, expiry and activation window
+// of the rules matching the selector that are stored already over to their
+// new documents, so saving an unchanged rule does not touch its timestamps,
+// drop its metadata or make a temporary rule permanent.
+func (a *Adapter) keepStored(ctx context.Context, selector interface{}, lines []CasbinRule, docs []interface{}) error {
+	cursor, err := a.collection.Find(ctx, selector)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	stored := map[string]bson.Raw{}
+	for cursor.Next(ctx) {
+		// The document is only valid until the next call to Next.
+		doc := make(bson.Raw, len(cursor.Current))
+		copy(doc, cursor.Current)
+		line, err := a.decodeLine(doc)
+		if err != nil {
+			return err
+		}
+		stored[line.key()] = doc
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	for i, line := range lines {
+		old, ok := stored[line.key()]
+		if !ok {
+			continue
+		}
+		doc := docs[i].(bson.D)
+		for j, e := range doc {
+			if e.Key != a.schema.CreatedAt && e.Key != a.schema.UpdatedAt {
+				continue
+			}
+			if t, ok := old.Lookup(e.Key).TimeOK(); ok {
+				doc[j].Value = t
+			}
+		}
+		if a.metadata {
+			if meta, err := old.LookupErr(a.schema.Meta); err == nil {
+				doc = append(doc, bson.E{Key: a.schema.Meta, Value: meta})
+			}
+		}
+		for _, field := range a.keptTimes() {
+			if t, ok := old.Lookup(field).TimeOK(); ok {
+				doc = append(doc, bson.E{Key: field, Value: t})
+			}
+		}
+		docs[i] = doc
+	}
+	return nil
+}
+
+// replaceDocuments replaces the documents matching the selector with docs,
+// in place. Unlike replaceCollection this keeps the existing indexes, but
+// readers may observe a partial policy while it runs, unless the adapter uses
+// transactions.
+func (a *Adapter) replaceDocuments(ctx context.Context, selector interface{}, docs []interface{}) error {
+	return a.withTransaction(ctx, func(ctx context.Context) error {
+		if err := a.deleteMany(ctx, selector); err != nil {
+			return err
+		}
+
+		// InsertMany rejects an empty document list.
+		if len(docs) == 0 {
+			return nil
+		}
+		return a.insertMany(ctx, a.collection, docs)
+	})
+}
+
+// replaceFiltered replaces the documents matching the filter of a filtered
+// load with docs, see WithFilteredSave. The lines of rules added to the model
+// may not match the filter, and are only stored if they are not stored
+// already.
+func (a *Adapter) replaceFiltered(ctx context.Context, selector interface{}, lines []CasbinRule, docs []interface{}) error {
+	return a.withTransaction(ctx, func(ctx context.Context) error {
+		if err := a.deleteMany(ctx, selector); err != nil {
+			return err
+		}
+
+		if len(docs) == 0 {
+			return nil
+		}
+		models := make([]mongo.WriteModel, 0, len(docs))
+		for i, line := range lines {
+			models = append(models, a.upsertDocument(line, docs[i]))
+		}
+		return a.bulkWrite(ctx, models)
+	})
+}
+
+// saveIncremental makes the rules matching the selector equal lines by
+// removing the stored rules lines lacks and inserting the lines that are not
+// stored, see WithIncrementalSave. Stored rules held by lines are left
+// alone, which keeps their timestamps, metadata, expiry and activation
+// window. If partial is true, the selector is the filter of a filtered load,
+// and lines are only inserted if they are not stored outside of it.
+func (a *Adapter) saveIncremental(ctx context.Context, selector interface{}, partial bool, lines []CasbinRule) error {
+	return a.withTransaction(ctx, func(ctx context.Context) error {
+		cursor, err := a.collection.Find(ctx, selector)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		stored := map[string][]interface{}{}
+		n := 0
+		for cursor.Next(ctx) {
+			line, err := a.decodeLine(cursor.Current)
+			if err != nil {
+				return err
+			}
+			stored[line.key()] = append(stored[line.key()], cursor.Current.Lookup("_id"))
+			n++
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		observeQuery(ctx, selector, int64(n))
+
+		var added []CasbinRule
+		for _, line := range lines {
+			if ids := stored[line.key()]; len(ids) > 0 {
+				stored[line.key()] = ids[1:]
+				continue
+			}
+			added = append(added, line)
+		}
+
+		ids := bson.A{}
+		for _, rest := range stored {
+			ids = append(ids, rest...)
+		}
+		a.debug("saving policy incrementally", "collection", a.collectionName, "added", len(added), "removed", len(ids))
+		if len(ids) > 0 {
+			if err := a.deleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+				return err
+			}
+		}
+		if len(added) == 0 {
+			return nil
+		}
+		if partial {
+			models := make([]mongo.WriteModel, 0, len(added))
+			for _, line := range added {
+				models = append(models, a.upsertModel(line))
+			}
+			return a.bulkWrite(ctx, models)
+		}
+		docs := make([]interface{}, 0, len(added))
+		for _, line := range added {
+			docs = append(docs, a.document(line))
+		}
+		return a.insertMany(ctx, a.collection, docs)
+	})
+}
+
+// replaceCollection writes the documents to a staging collection, indexes it,
+// and then renames it over the policy collection. Readers observe either the
+// old or the new policy, never a partial one, and a failed save leaves the
+// stored policy untouched.
+func (a *Adapter) replaceCollection(ctx context.Context, docs []interface{}) error {
+	db := a.collection.Database()
+	stagingName := a.collectionName + "_staging_" + primitive.NewObjectID().Hex()
+	staging := db.Collection(stagingName, a.collectionOptions())
+
+	err := func() error {
+		if err := a.insertMany(ctx, staging, docs); err != nil {
+			return err
+		}
+		if err := a.createIndexes(ctx, staging); err != nil {
+			return err
+		}
+
+		// renameCollection is an admin command and takes full namespaces.
+		rename := bson.D{
+			{Key: "renameCollection", Value: db.Name() + "." + stagingName},
+			{Key: "to", Value: db.Name() + "." + a.collectionName},
+			{Key: "dropTarget", Value: true},
+		}
+		if err := a.client.Database("admin").RunCommand(ctx, rename).Err(); err != nil {
+			return err
+		}
+		a.debug("replaced policy collection", "collection", a.collectionName, "count", len(docs))
+		return nil
+	}()
+	if err != nil {
+		// Best effort; the staging collection is unused either way.
+		_ = staging.Drop(context.Background())
+	}
+	return err
+}
+
+// AddPolicy adds a policy rule to the storage. Whether a rule that is stored
+// already is added again depends on the DuplicateMode, see WithDuplicates.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx is like AddPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) (err error) {
+	ctx, end := a.begin(ctx, "AddPolicy")
+	defer func() { err = end(err) }()
+
+	if err := a.validateRule(ptype, rule); err != nil {
+		return err
+	}
+
+	return a.addLine(ctx, a.ruleLine(ptype, rule))
+}
+
+// addLine stores a single rule.
+func (a *Adapter) addLine(ctx context.Context, line CasbinRule) error {
+	c := change{op: "add", ptype: line.PType, rules: [][]string{line.toStringPolicy()}, rejectable: true}
+
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		if a.duplicates == DuplicatesIgnore {
+			return a.bulkWrite(ctx, []mongo.WriteModel{a.upsertModel(line)})
+		}
+
+		if _, err := a.collection.InsertOne(ctx, a.document(line)); err != nil {
+			return err
+		}
+		a.debug("inserted rules", "collection", a.collectionName, "count", 1)
+		return nil
+	})
+}
+
+// AddPolicies adds policy rules to the storage in a single round trip.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.AddPoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// AddPoliciesCtx is like AddPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) AddPoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) (err error) {
+	ctx, end := a.begin(ctx, "AddPolicies")
+	defer func() { err = end(err) }()
+
+	if len(rules) == 0 {
+		return nil
+	}
+	if err := a.validateRules(ptype, rules); err != nil {
+		return err
+	}
+
+	c := change{op: "add", ptype: ptype, rules: rules}
+	if a.duplicates == DuplicatesIgnore {
+		models := make([]mongo.WriteModel, 0, len(rules))
+		for _, rule := range rules {
+			models = append(models, a.upsertModel(a.ruleLine(ptype, rule)))
+		}
+		c.rejectable = true
+
+		return a.withHistory(ctx, c, func(ctx context.Context) error {
+			return a.bulkWrite(ctx, models)
+		})
+	}
+
+	lines := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, a.document(a.ruleLine(ptype, rule)))
+	}
+
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.insertMany(ctx, a.collection, lines)
+	})
+}
+
+// upsertModel returns a write that stores the line unless it is stored
+// already.
+func (a *Adapter) upsertModel(line CasbinRule) mongo.WriteModel {
+	return a.upsertDocument(line, a.document(line))
+}
+
+// upsertDocument is like upsertModel, but stores the given document of the
+// line.
+func (a *Adapter) upsertDocument(line CasbinRule, doc interface{}) mongo.WriteModel {
+	selector := a.selector(line)
+	if line.Tenant == "" {
+		// Only a rule without a tenant is the same rule. An upsert must match
+		// the shard key exactly, which null does for a missing field.
+		var missing interface{} = bson.M{"$exists": false}
+		if a.inShardKey("tenant") {
+			missing = nil
+		}
+		selector = append(selector, bson.E{Key: a.schema.Tenant, Value: missing})
+	}
+
+	model := mongo.NewUpdateOneModel().
+		SetFilter(selector).
+		SetUpdate(bson.M{"$setOnInsert": doc}).
+		SetUpsert(true)
+	if a.collation != nil {
+		model.SetCollation(a.collation)
+	}
+	return model
+}
+
+// inShardKey reports whether the field is part of the shard key, see
+// WithShardKey.
+func (a *Adapter) inShardKey(field string) bool {
+	for _, f := range a.shardKey {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// RemovePolicy removes a policy rule from the storage. Every document that
+// exactly matches the rule is removed, so duplicates cannot resurface on the
+// next load.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx is like RemovePolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) (err error) {
+	ctx, end := a.begin(ctx, "RemovePolicy")
+	defer func() { err = end(err) }()
+
+	if err := a.checkUnscoped(ctx, "remove"); err != nil {
+		return err
+	}
+	c := change{op: "remove", ptype: ptype, rules: [][]string{rule}}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.deleteMany(ctx, a.selector(a.ruleLine(ptype, rule)))
+	})
+}
+
+// RemovePolicies removes policy rules from the storage in a single round
+// trip. As with RemovePolicy, every exact match of each rule is removed.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.RemovePoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// RemovePoliciesCtx is like RemovePolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) RemovePoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) (err error) {
+	ctx, end := a.begin(ctx, "RemovePolicies")
+	defer func() { err = end(err) }()
+
+	if len(rules) == 0 {
+		return nil
+	}
+	if err := a.checkUnscoped(ctx, "remove"); err != nil {
+		return err
+	}
+
+	models := make([]mongo.WriteModel, 0, len(rules))
+	for _, rule := range rules {
+		models = append(models, a.deleteModel(a.selector(a.ruleLine(ptype, rule))))
+	}
+
+	c := change{op: "remove", ptype: ptype, rules: rules}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.bulkWrite(ctx, models)
+	})
+}
+
+// ruleLine converts a rule into the line stored by this adapter.
+func (a *Adapter) ruleLine(ptype string, rule []string) CasbinRule {
+	line := savePolicyLine(a.normalizeRule(ptype, rule))
+	line.Tenant = a.tenant
+	a.sawTenant(line.Tenant)
+	return line
+}
+
+// sawTenant records that the collection holds rules of tenants if tenant is
+// not empty.
+func (a *Adapter) sawTenant(tenant string) {
+	if tenant != "" {
+		atomic.StoreInt32(a.tenantRules, tenantRulesFound)
+	}
+}
+
+// checkUnscoped refuses to change rules through an unscoped adapter whose
+// collection holds rules of tenants. Such an adapter loads the rules of all
+// tenants into one model, where equal rules of different tenants merge, so
+// saving would strip the tenants and drop the merged rules, and removing or
+// updating a rule would change it for every tenant. The tenant field is only
+// indexed with the WithTenant option, so a collection found without rules of
+// tenants is not searched again, unless the adapter sees one later.
+func (a *Adapter) checkUnscoped(ctx context.Context, op string) error {
+	if a.tenant != "" || atomic.LoadInt32(a.tenantRules) == tenantRulesNone {
+		return nil
+	}
+	selector := a.scope(bson.M{a.schema.Tenant: bson.M{"$exists": true}})
+	err := a.collection.FindOne(ctx, selector, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		atomic.CompareAndSwapInt32(a.tenantRules, tenantRulesUnknown, tenantRulesNone)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(a.tenantRules, tenantRulesFound)
+	return errors.New("cannot " + op + " the rules of all tenants, use WithTenant")
+}
+
+// scope restricts a selector to the adapter's tenant, if it has one, and to
+// rules that are not deleted.
+func (a *Adapter) scope(selector bson.M) bson.M {
+	if a.tenant != "" {
+		selector[a.schema.Tenant] = a.tenant
+	}
+	if a.softDelete {
+		selector[a.schema.DeletedAt] = bson.M{"$exists": false}
+	}
+	return selector
+}
+
+// deleteMany removes the rules matching the selector, or marks them deleted
+// in soft-delete mode.
+func (a *Adapter) deleteMany(ctx context.Context, selector interface{}) error {
+	if a.softDelete {
+		res, err := a.collection.UpdateMany(ctx, selector, a.tombstone(), a.updateOptions())
+		if err != nil {
+			return err
+		}
+		a.debug("marked rules deleted", "collection", a.collectionName, "selector", selector, "count", res.ModifiedCount)
+		observeQuery(ctx, selector, res.ModifiedCount)
+		return nil
+	}
+
+	res, err := a.collection.DeleteMany(ctx, selector, a.deleteOptions())
+	if err != nil {
+		return err
+	}
+	a.debug("deleted rules", "collection", a.collectionName, "selector", selector, "count", res.DeletedCount)
+	observeQuery(ctx, selector, res.DeletedCount)
+	return nil
+}
+
+// bulkWrite runs the write models against the policy collection.
+func (a *Adapter) bulkWrite(ctx context.Context, models []mongo.WriteModel) error {
+	res, err := a.collection.BulkWrite(ctx, models)
+	if err != nil {
+		return err
+	}
+	a.debug("wrote rules", "collection", a.collectionName,
+		"inserted", res.InsertedCount, "modified", res.ModifiedCount, "deleted", res.DeletedCount)
+	observeQuery(ctx, nil, res.InsertedCount+res.ModifiedCount+res.DeletedCount+res.UpsertedCount)
+	return nil
+}
+
+// deleteModel is like deleteMany, for use in a bulk write.
+func (a *Adapter) deleteModel(selector interface{}) mongo.WriteModel {
+	if a.softDelete {
+		return a.updateModel(selector, a.tombstone())
+	}
+	model := mongo.NewDeleteManyModel().SetFilter(selector)
+	if a.collation != nil {
+		model.SetCollation(a.collation)
+	}
+	return model
+}
+
+// updateModel returns a write that modifies the rules matching the
+// selector, for use in a bulk write.
+func (a *Adapter) updateModel(selector interface{}, update interface{}) mongo.WriteModel {
+	model := mongo.NewUpdateManyModel().SetFilter(selector).SetUpdate(update)
+	if a.collation != nil {
+		model.SetCollation(a.collation)
+	}
+	return model
+}
+
+// filteredSelector builds the selector used by the filtered operations.
+// Empty field values act as wildcards and are left out of the selector.
+func (a *Adapter) filteredSelector(ptype string, fieldIndex int, fieldValues ...string) bson.M {
+	selector := bson.M{a.schema.PType: a.normalize(-1, ptype)}
+
+	for i, v := range fieldValues {
+		if v == "" {
+			continue
+		}
+		if idx := fieldIndex + i; idx >= 0 && (a.schema.Array != "" || idx < len(a.schema.Values)) {
+			selector[a.schema.value(idx)] = a.encryptValue(idx, a.normalize(idx, v))
+		}
+	}
+
+	return selector
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+// Empty field values act as wildcards and are left out of the selector.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return a.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx is like RemoveFilteredPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) (err error) {
+	ctx, end := a.begin(ctx, "RemoveFilteredPolicy")
+	defer func() { err = end(err) }()
+
+	if err := a.checkUnscoped(ctx, "remove"); err != nil {
+		return err
+	}
+	selector := a.scope(a.filteredSelector(ptype, fieldIndex, fieldValues...))
+	if a.dryRunReport != nil {
+		return a.dryRun(ctx, "RemoveFilteredPolicy", selector, nil)
+	}
+
+	c := change{op: "remove", ptype: ptype, filter: filterValues(fieldIndex, fieldValues)}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.deleteMany(ctx, selector)
+	})
+}
+
+// RemoveFilteredPolicyWithRules is like RemoveFilteredPolicy, but returns the
+// removed rules, so that the exact change can be passed on, for example to
+// the UpdateForRemovePolicies method of a watcher. The matching rules are
+// read first and then removed by their _id; rules added in between are left
+// alone. With WithTransactions, both happen in one transaction.
+func (a *Adapter) RemoveFilteredPolicyWithRules(sec string, ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.RemoveFilteredPolicyWithRulesCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyWithRulesCtx is like RemoveFilteredPolicyWithRules but honors the deadline and cancellation of ctx.
+func (a *Adapter) RemoveFilteredPolicyWithRulesCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) (rules [][]string, err error) {
+	ctx, end := a.begin(ctx, "RemoveFilteredPolicy")
+	defer func() { err = end(err) }()
+
+	if err := a.checkUnscoped(ctx, "remove"); err != nil {
+		return nil, err
+	}
+	selector := a.scope(a.filteredSelector(ptype, fieldIndex, fieldValues...))
+	if a.dryRunReport != nil {
+		return nil, a.dryRun(ctx, "RemoveFilteredPolicy", selector, nil)
+	}
+
+	c := change{op: "remove", ptype: ptype, filter: filterValues(fieldIndex, fieldValues)}
+	err = a.withHistory(ctx, c, func(ctx context.Context) error {
+		cursor, err := a.collection.Find(ctx, selector, a.findOptions())
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		rules = [][]string{}
+		ids := bson.A{}
+		for cursor.Next(ctx) {
+			line, err := a.decodeLine(cursor.Current)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, line.toStringPolicy())
+			ids = append(ids, cursor.Current.Lookup("_id"))
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return a.deleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// PurgeDeleted permanently removes the rules that were marked deleted more
+// than olderThan ago, see WithSoftDelete, and returns how many were removed.
+func (a *Adapter) PurgeDeleted(olderThan time.Duration) (int64, error) {
+	return a.PurgeDeletedCtx(context.Background(), olderThan)
+}
+
+// PurgeDeletedCtx is like PurgeDeleted but honors the deadline and cancellation of ctx.
+func (a *Adapter) PurgeDeletedCtx(ctx context.Context, olderThan time.Duration) (n int64, err error) {
+	ctx, end := a.begin(ctx, "PurgeDeleted")
+	defer func() { err = end(err) }()
+
+	if !a.softDelete {
+		return 0, errors.New("soft delete is not enabled")
+	}
+
+	selector := bson.M{a.schema.DeletedAt: bson.M{"$lt": time.Now().Add(-olderThan)}}
+	if a.tenant != "" {
+		selector[a.schema.Tenant] = a.tenant
+	}
+
+	res, err := a.collection.DeleteMany(ctx, selector)
+	if err != nil {
+		return 0, err
+	}
+	a.debug("purged deleted rules", "collection", a.collectionName, "count", res.DeletedCount)
+	return res.DeletedCount, nil
+}
+
+// UpdatePolicy replaces a policy rule in the storage. Every document that
+// exactly matches the old rule is rewritten in place, so there is no window
+// where neither rule is stored. If the old rule is not stored, UpdatePolicy
+// returns ErrRuleNotFound.
+func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicyCtx(context.Background(), sec, ptype, oldRule, newRule)
+}
+
+// UpdatePolicyCtx is like UpdatePolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) UpdatePolicyCtx(ctx context.Context, sec string, ptype string, oldRule, newRule []string) (err error) {
+	ctx, end := a.begin(ctx, "UpdatePolicy")
+	defer func() { err = end(err) }()
+
+	if err := a.validateRule(ptype, newRule); err != nil {
+		return err
+	}
+	if err := a.checkUnscoped(ctx, "update"); err != nil {
+		return err
+	}
+
+	oldLine := a.selector(a.ruleLine(ptype, oldRule))
+	newLine := a.ruleLine(ptype, newRule)
+	c := change{op: "update", ptype: ptype, rules: [][]string{oldRule}, newRules: [][]string{newRule}}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		res, err := a.collection.UpdateMany(ctx, oldLine, a.update(newLine), a.updateOptions())
+		if err != nil {
+			return err
+		}
+		a.debug("updated rules", "collection", a.collectionName, "selector", oldLine, "count", res.ModifiedCount)
+		if res.MatchedCount == 0 {
+			return ErrRuleNotFound
+		}
+		return nil
+	})
+}
+
+// UpdatePolicies replaces policy rules in the storage in a single round trip.
+// oldRules[i] is replaced by newRules[i].
+func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return a.UpdatePoliciesCtx(context.Background(), sec, ptype, oldRules, newRules)
+}
+
+// UpdatePoliciesCtx is like UpdatePolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) UpdatePoliciesCtx(ctx context.Context, sec string, ptype string, oldRules, newRules [][]string) (err error) {
+	ctx, end := a.begin(ctx, "UpdatePolicies")
+	defer func() { err = end(err) }()
+
+	if len(oldRules) != len(newRules) {
+		return errors.New("the number of old and new rules must match")
+	}
+	if len(oldRules) == 0 {
+		return nil
+	}
+	if err := a.validateRules(ptype, newRules); err != nil {
+		return err
+	}
+	if err := a.checkUnscoped(ctx, "update"); err != nil {
+		return err
+	}
+
+	models := make([]mongo.WriteModel, 0, len(oldRules))
+	for i := range oldRules {
+		oldLine := a.selector(a.ruleLine(ptype, oldRules[i]))
+		newLine := a.ruleLine(ptype, newRules[i])
+		models = append(models, a.updateModel(oldLine, a.update(newLine)))
+	}
+
+	c := change{op: "update", ptype: ptype, rules: oldRules, newRules: newRules}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.bulkWrite(ctx, models)
+	})
+}
+
+// UpdateFilteredPolicies replaces the policy rules that match the filter with
+// newRules, and returns the rules that were replaced.
+func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.UpdateFilteredPoliciesCtx(context.Background(), sec, ptype, newRules, fieldIndex, fieldValues...)
+}
+
+// UpdateFilteredPoliciesCtx is like UpdateFilteredPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) UpdateFilteredPoliciesCtx(ctx context.Context, sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) (rules [][]string, err error) {
+	ctx, end := a.begin(ctx, "UpdateFilteredPolicies")
+	defer func() { err = end(err) }()
+
+	if err := a.validateRules(ptype, newRules); err != nil {
+		return nil, err
+	}
+	if err := a.checkUnscoped(ctx, "update"); err != nil {
+		return nil, err
+	}
+
+	selector := a.scope(a.filteredSelector(ptype, fieldIndex, fieldValues...))
+
+	var oldLines []CasbinRule
+	c := change{op: "update", ptype: ptype, newRules: newRules, filter: filterValues(fieldIndex, fieldValues)}
+	err = a.withHistory(ctx, c, func(ctx context.Context) error {
+		cursor, err := a.collection.Find(ctx, selector, a.findOptions())
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		oldLines = nil
+		ids := bson.A{}
+		for cursor.Next(ctx) {
+			line, err := a.decodeLine(cursor.Current)
+			if err != nil {
+				return err
+			}
+			oldLines = append(oldLines, line)
+			ids = append(ids, cursor.Current.Lookup("_id"))
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		// Only the rules that were read are replaced, so the returned rules
+		// are the removed ones even without a transaction.
+		models := make([]mongo.WriteModel, 0, len(newRules)+1)
+		if len(ids) > 0 {
+			models = append(models, a.deleteModel(bson.M{"_id": bson.M{"$in": ids}}))
+		}
+		for _, rule := range newRules {
+			doc := a.document(a.ruleLine(ptype, rule))
+			models = append(models, mongo.NewInsertOneModel().SetDocument(doc))
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		return a.bulkWrite(ctx, models)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oldRules := make([][]string, 0, len(oldLines))
+	for _, line := range oldLines {
+		oldRules = append(oldRules, line.toStringPolicy())
+	}
+	return oldRules, nil
 }
@@ -0,0 +1,127 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adaptertest runs the MongoDB adapter against a throwaway server, so
+// that the policy logic of an application can be unit-tested without a
+// MongoDB server of its own:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(adaptertest.Run(m))
+//	}
+//
+//	func TestPolicy(t *testing.T) {
+//		a := adaptertest.New(t)
+//		e, _ := casbin.NewEnforcer("rbac_model.conf", a)
+//		...
+//	}
+//
+// The server is a real mongod, downloaded once into a cache directory and run
+// in memory with memongo. Each adapter gets a database of its own, dropped
+// when its test ends. If TEST_MONGODB_URL is set, that server is used
+// instead. NewWithContainer runs the server in a Docker container instead.
+//
+// The driver's mtest mock is not used, as it replays scripted replies rather
+// than storing rules.
+package adaptertest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	mongodbadapter "github.com/casbin/mongodb-adapter/v2"
+	"github.com/tryvium-travels/memongo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoVersion is the version of the server started for the tests.
+var MongoVersion = "7.0.12"
+
+var (
+	mu     sync.Mutex
+	server *memongo.Server
+)
+
+// uri returns the URL of the server for the tests, starting it on first use.
+func uri() (string, error) {
+	if url := os.Getenv("TEST_MONGODB_URL"); url != "" {
+		return url, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if server == nil {
+		// A replica set supports transactions and change streams.
+		s, err := memongo.StartWithOptions(&memongo.Options{MongoVersion: MongoVersion, ShouldUseReplica: true})
+		if err != nil {
+			return "", err
+		}
+		server = s
+	}
+	return server.URI(), nil
+}
+
+// New returns an adapter of a new database on the server for the tests,
+// configured with opts. The database is dropped and the adapter closed when
+// the test ends.
+func New(t testing.TB, opts ...mongodbadapter.Option) *mongodbadapter.Adapter {
+	t.Helper()
+
+	url, err := uri()
+	if err != nil {
+		t.Fatalf("adaptertest: cannot start MongoDB: %v", err)
+	}
+	return newAdapter(t, url, opts)
+}
+
+// newAdapter returns an adapter of a new database on the server at url, which
+// is dropped when the test ends.
+func newAdapter(t testing.TB, url string, opts []mongodbadapter.Option) *mongodbadapter.Adapter {
+	t.Helper()
+
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+	if err != nil {
+		t.Fatalf("adaptertest: cannot connect to MongoDB: %v", err)
+	}
+
+	db := memongo.RandomDatabase()
+	a, err := mongodbadapter.NewAdapterWithClient(client, db, opts...)
+	if err != nil {
+		client.Disconnect(context.Background())
+		t.Fatalf("adaptertest: cannot create the adapter: %v", err)
+	}
+
+	t.Cleanup(func() {
+		a.Close()
+		client.Database(db).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	return a
+}
+
+// Run runs the tests and stops the server started for them, if any. Call it
+// from TestMain.
+func Run(m *testing.M) int {
+	code := m.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if server != nil {
+		server.Stop()
+		server = nil
+	}
+	return code
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adaptertest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	mongodbadapter "github.com/casbin/mongodb-adapter/v2"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(Run(m))
+}
+
+func TestNew(t *testing.T) {
+	a := New(t)
+
+	e, err := casbin.NewEnforcer("../examples/rbac_model.conf", a)
+	if err != nil {
+		t.Fatalf("Expected NewEnforcer() to be successful; got %v", err)
+	}
+	if _, err := e.AddPolicy("alice", "data1", "read"); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	if ok, _ := e.Enforce("alice", "data1", "read"); !ok {
+		t.Error("Expected the stored rule to allow the request")
+	}
+
+	// Each adapter has a database of its own.
+	if rules, err := New(t).GetPolicies("p", 0); err != nil || len(rules) != 0 {
+		t.Errorf("Expected a new adapter to be empty; got %v, %v", rules, err)
+	}
+}
+
+func TestNewWithContainer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the container in short mode")
+	}
+	a := NewWithContainer(t, mongodbadapter.WithTimestamps())
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if found, err := a.HasPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil || !found {
+		t.Errorf("Expected HasPolicy() to find the rule; got %v, %v", found, err)
+	}
+}
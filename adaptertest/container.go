@@ -0,0 +1,55 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adaptertest
+
+import (
+	"context"
+	"testing"
+
+	mongodbadapter "github.com/casbin/mongodb-adapter/v2"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+)
+
+// ContainerImage is the Docker image of the server started by
+// NewWithContainer.
+var ContainerImage = "mongo:7.0"
+
+// NewWithContainer starts a MongoDB server in a throwaway Docker container
+// with testcontainers, and returns an adapter pointed at it, configured with
+// opts. The server is a single-node replica set, so transactions and change
+// streams work. The container is removed when the test ends. The test is
+// skipped when Docker is not available.
+func NewWithContainer(t testing.TB, opts ...mongodbadapter.Option) *mongodbadapter.Adapter {
+	t.Helper()
+
+	ctx := context.Background()
+	container, err := mongodb.Run(ctx, ContainerImage, mongodb.WithReplicaSet("rs0"))
+	if container != nil {
+		// Cleanups run last in, first out, so the adapter is closed first.
+		t.Cleanup(func() {
+			testcontainers.TerminateContainer(container)
+		})
+	}
+	if err != nil {
+		t.Skipf("adaptertest: cannot start a MongoDB container: %v", err)
+	}
+
+	url, err := container.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("adaptertest: cannot get the URL of the MongoDB container: %v", err)
+	}
+	return newAdapter(t, url, opts)
+}
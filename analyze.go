@@ -0,0 +1,211 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IndexReport tells how the indexes of the policy collection serve the
+// queries of the adapter, see AnalyzeIndexes.
+type IndexReport struct {
+	// Queries are the plans the server chose for the typical queries of the
+	// adapter.
+	Queries []QueryPlan
+	// Missing names the queries that scan the whole collection, which an
+	// index of their fields would speed up, see WithFieldIndexes and
+	// WithIndexes.
+	Missing []string
+	// Unused names the indexes that have not served a query since the
+	// server started. The _id index and unique and TTL indexes are left out,
+	// as they are needed regardless.
+	Unused []string
+}
+
+// QueryPlan is the plan the server chose for a query of the adapter.
+type QueryPlan struct {
+	// Query names the query, such as "RemovePolicy".
+	Query string
+	// Shape is the selector of the query, see SlowOperation.
+	Shape string
+	// Index is the index the query uses, or empty if it scans the whole
+	// collection.
+	Index string
+}
+
+// AnalyzeIndexes explains the typical queries of the adapter against the
+// stored policy, such as removing a rule or the rules of a subject, and
+// reports the queries that scan the whole collection and the indexes that
+// have not been used since the server started. The queries use the values
+// of a stored rule, and are not run. Reading the index statistics requires
+// the indexStats privilege.
+func (a *Adapter) AnalyzeIndexes() (*IndexReport, error) {
+	return a.AnalyzeIndexesCtx(context.Background())
+}
+
+// AnalyzeIndexesCtx is like AnalyzeIndexes but honors the deadline and cancellation of ctx.
+func (a *Adapter) AnalyzeIndexesCtx(ctx context.Context) (report *IndexReport, err error) {
+	ctx, end := a.begin(ctx, "AnalyzeIndexes")
+	defer func() { err = end(err) }()
+
+	// The queries use the values of a stored rule, or placeholders for an
+	// empty collection.
+	sample := a.ruleLine("p", []string{"alice", "data1", "read"})
+	doc, err := a.collection.FindOne(ctx, a.scope(bson.M{})).Raw()
+	switch {
+	case err == nil:
+		if sample, err = a.decodeLine(doc); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return nil, err
+	}
+	values := sample.toStringPolicy()
+	for len(values) < 2 {
+		values = append(values, "")
+	}
+
+	queries := []struct {
+		name     string
+		selector interface{}
+	}{
+		{"LoadFilteredPolicy", a.scope(bson.M{a.schema.PType: sample.PType})},
+		{"RemovePolicy", a.selector(sample)},
+		{"RemoveFilteredPolicy", a.scope(a.filteredSelector(sample.PType, 0, values[0]))},
+		{"GetPolicies", a.scope(a.filteredSelector(sample.PType, 1, values[1]))},
+	}
+
+	report = &IndexReport{}
+	for _, q := range queries {
+		selector := a.active(q.selector)
+		index, err := a.explain(ctx, selector)
+		if err != nil {
+			return nil, err
+		}
+		report.Queries = append(report.Queries, QueryPlan{Query: q.name, Shape: queryShape(selector), Index: index})
+		if index == "" {
+			report.Missing = append(report.Missing, q.name)
+		}
+	}
+
+	report.Unused, err = a.unusedIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// explain returns the index the server would use to find the rules matching
+// the selector, or an empty string for a collection scan.
+func (a *Adapter) explain(ctx context.Context, selector interface{}) (string, error) {
+	find := bson.D{{Key: "find", Value: a.collectionName}, {Key: "filter", Value: selector}}
+	if a.collation != nil {
+		find = append(find, bson.E{Key: "collation", Value: bson.Raw(a.collation.ToDocument())})
+	}
+	cmd := bson.D{{Key: "explain", Value: find}, {Key: "verbosity", Value: "queryPlanner"}}
+
+	res, err := a.collection.Database().RunCommand(ctx, cmd).Raw()
+	if err != nil {
+		return "", err
+	}
+	plan, _ := res.Lookup("queryPlanner", "winningPlan").DocumentOK()
+	return planIndex(plan), nil
+}
+
+// planIndex returns the index scanned by a query plan, if any. It walks the
+// input stages, the query plan of the slot-based engine and the plans of the
+// shards.
+func planIndex(plan bson.Raw) string {
+	if plan == nil {
+		return ""
+	}
+	if name, ok := plan.Lookup("indexName").StringValueOK(); ok {
+		return name
+	}
+
+	var children []bson.Raw
+	for _, key := range []string{"queryPlan", "inputStage", "winningPlan"} {
+		if child, ok := plan.Lookup(key).DocumentOK(); ok {
+			children = append(children, child)
+		}
+	}
+	for _, key := range []string{"inputStages", "shards"} {
+		if array, ok := plan.Lookup(key).ArrayOK(); ok {
+			elems, _ := array.Values()
+			for _, elem := range elems {
+				if child, ok := elem.DocumentOK(); ok {
+					children = append(children, child)
+				}
+			}
+		}
+	}
+
+	for _, child := range children {
+		if name := planIndex(child); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// unusedIndexes returns the names of the indexes that have not served a
+// query since the server started, summed over all shards.
+func (a *Adapter) unusedIndexes(ctx context.Context) ([]string, error) {
+	cursor, err := a.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$indexStats", Value: bson.M{}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ops := map[string]int64{}
+	for cursor.Next(ctx) {
+		var stat struct {
+			Name     string `bson:"name"`
+			Accesses struct {
+				Ops int64 `bson:"ops"`
+			} `bson:"accesses"`
+			Spec struct {
+				Unique             bool   `bson:"unique"`
+				ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+			} `bson:"spec"`
+		}
+		if err := cursor.Decode(&stat); err != nil {
+			return nil, err
+		}
+		if stat.Name == "_id_" || stat.Spec.Unique || stat.Spec.ExpireAfterSeconds != nil {
+			continue
+		}
+		ops[stat.Name] += stat.Accesses.Ops
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	unused := []string{}
+	for name, n := range ops {
+		if n == 0 {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	return unused, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestAnalyzeIndexes(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_analyze", WithFieldIndexes())
+
+	if err := a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+		t.Fatalf("Expected AddPolicies() to be successful; got %v", err)
+	}
+
+	// Without indexes, every query scans the collection.
+	report, err := a.AnalyzeIndexes()
+	if err != nil {
+		t.Fatalf("Expected AnalyzeIndexes() to be successful; got %v", err)
+	}
+	if len(report.Queries) != 4 || len(report.Missing) != 4 || len(report.Unused) != 0 {
+		t.Errorf("Expected 4 queries missing an index; got %+v", report)
+	}
+
+	indexed := newTestAdapter(t, "casbin_rule_analyze")
+	defer indexed.Close()
+
+	report, err = indexed.AnalyzeIndexes()
+	if err != nil {
+		t.Fatalf("Expected AnalyzeIndexes() to be successful; got %v", err)
+	}
+	if len(report.Missing) != 0 {
+		t.Errorf("Expected no query to miss an index; got %v", report.Missing)
+	}
+	for _, q := range report.Queries {
+		if q.Index == "" || q.Shape == "" {
+			t.Errorf("Expected the query to use an index; got %+v", q)
+		}
+	}
+	// Nothing has queried the rules yet.
+	if len(report.Unused) != 7 {
+		t.Errorf("Expected the 7 rule field indexes to be unused; got %v", report.Unused)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEntry describes a change of the stored policy as recorded in the audit
+// log, see WithAudit, and as passed to Hooks.
+type AuditEntry struct {
+	Time time.Time `bson:"time"`
+	// Actor is the actor attached to the context of the change with
+	// ContextWithActor, if any.
+	Actor string `bson:"actor,omitempty"`
+	// Operation is one of "add", "remove", "update", "save", "restore" and
+	// "import".
+	Operation string `bson:"operation"`
+	PType     string `bson:"ptype,omitempty"`
+	// Rules are the rules added, removed or replaced. They are not recorded
+	// for "save", "restore" and "import", which may concern the whole
+	// policy.
+	Rules [][]string `bson:"rules,omitempty"`
+	// NewRules are the rules that replaced Rules or the rules matching
+	// Filter in an update.
+	NewRules [][]string `bson:"new_rules,omitempty"`
+	// Filter are the field values of a filtered removal or update, starting
+	// with v0; empty values match any value.
+	Filter []string `bson:"filter,omitempty"`
+}
+
+// auditDoc is the document stored in the audit log for each change.
+type auditDoc struct {
+	Tenant     string `bson:"tenant"`
+	AuditEntry `bson:",inline"`
+}
+
+// change describes a write of the adapter, for the history and the audit log.
+type change struct {
+	op       string
+	ptype    string
+	rules    [][]string
+	newRules [][]string
+	filter   []string
+	// rejectable tells whether the write is a single-document write or
+	// consists of upserts, which may run again after the server rejected it
+	// for throttling, see WithCosmosDB.
+	rejectable bool
+}
+
+// actorKey is the context key of the actor, see ContextWithActor.
+type actorKey struct{}
+
+// ContextWithActor returns a copy of ctx that attributes the changes made
+// with it to actor in the audit log, such as the name of a user or service.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// createAuditLog creates the audit log as a capped collection of the
+// configured size, unless it exists already.
+func (a *Adapter) createAuditLog(ctx context.Context) error {
+	opts := options.CreateCollection()
+	if a.auditSize > 0 {
+		opts.SetCapped(true).SetSizeInBytes(a.auditSize)
+	}
+
+	err := a.auditLog.Database().CreateCollection(ctx, a.auditLog.Name(), opts)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == 48 { // NamespaceExists
+		return nil
+	}
+	return err
+}
+
+// recordAudit appends the change to the audit log. Capped collections cannot
+// be written in a transaction, so the entry is written once the change has
+// been committed.
+func (a *Adapter) recordAudit(ctx context.Context, entry AuditEntry) error {
+	_, err := a.auditLog.InsertOne(ctx, auditDoc{Tenant: a.tenant, AuditEntry: entry})
+	return err
+}
+
+// entry describes the change as recorded in the audit log.
+func (c change) entry(ctx context.Context) AuditEntry {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return AuditEntry{
+		Time:      time.Now(),
+		Actor:     actor,
+		Operation: c.op,
+		PType:     c.ptype,
+		Rules:     c.rules,
+		NewRules:  c.newRules,
+		Filter:    c.filter,
+	}
+}
+
+// filterValues returns the field values of a filtered operation, starting
+// with v0.
+func filterValues(fieldIndex int, fieldValues []string) []string {
+	if fieldIndex < 0 {
+		return fieldValues
+	}
+	return append(make([]string, fieldIndex), fieldValues...)
+}
+
+// RecentChanges returns up to limit of the latest changes recorded in the
+// audit log, newest first. It requires WithAudit.
+func (a *Adapter) RecentChanges(limit int64) ([]AuditEntry, error) {
+	return a.RecentChangesCtx(context.Background(), limit)
+}
+
+// RecentChangesCtx is like RecentChanges but honors the deadline and cancellation of ctx.
+func (a *Adapter) RecentChangesCtx(ctx context.Context, limit int64) (entries []AuditEntry, err error) {
+	ctx, end := a.begin(ctx, "RecentChanges")
+	defer func() { err = end(err) }()
+
+	if a.auditLog == nil {
+		return nil, errors.New("audit log is not enabled")
+	}
+
+	// A capped collection keeps its documents in insertion order.
+	sort := bson.D{{Key: "$natural", Value: -1}}
+	if a.auditSize == 0 {
+		sort = bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}
+	}
+	opts := options.Find().SetSort(sort).SetLimit(limit)
+
+	cursor, err := a.auditLog.Find(ctx, bson.M{"tenant": a.tenant}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries = []AuditEntry{}
+	for cursor.Next(ctx) {
+		var doc auditDoc
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		entries = append(entries, doc.AuditEntry)
+	}
+
+	return entries, cursor.Err()
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_audited", WithAudit("", 1<<20))
+	defer a.auditLog.Drop(context.Background())
+
+	ctx := ContextWithActor(context.Background(), "admin")
+	if err := a.AddPolicyCtx(ctx, "p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicyCtx() to be successful; got %v", err)
+	}
+	if err := a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+		t.Fatalf("Expected UpdatePolicy() to be successful; got %v", err)
+	}
+	if err := a.RemoveFilteredPolicy("p", "p", 1, "data1"); err != nil {
+		t.Fatalf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+
+	entries, err := a.RecentChanges(10)
+	if err != nil {
+		t.Fatalf("Expected RecentChanges() to be successful; got %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries; got %+v", entries)
+	}
+	if e := entries[0]; e.Operation != "remove" || !reflect.DeepEqual(e.Filter, []string{"", "data1"}) {
+		t.Errorf("Unexpected entry for the removal: %+v", e)
+	}
+	if e := entries[1]; e.Operation != "update" || !reflect.DeepEqual(e.NewRules, [][]string{{"alice", "data1", "write"}}) {
+		t.Errorf("Unexpected entry for the update: %+v", e)
+	}
+	if e := entries[2]; e.Operation != "add" || e.Actor != "admin" || e.PType != "p" || e.Time.IsZero() {
+		t.Errorf("Unexpected entry for the addition: %+v", e)
+	}
+
+	if entries, _ := a.RecentChanges(1); len(entries) != 1 {
+		t.Errorf("Expected RecentChanges() to honor the limit; got %+v", entries)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// backupLine is a line of a backup: a stored document in canonical Extended
+// JSON with its SHA-256 checksum.
+type backupLine struct {
+	Doc json.RawMessage `json:"doc"`
+	Sum string          `json:"sha256"`
+}
+
+// backupTrailer is the last line of a backup. Sum is the SHA-256 checksum of
+// the checksums of all documents, which tells a truncated backup or
+// reordered lines from a complete one.
+type backupTrailer struct {
+	Documents int    `json:"documents"`
+	Sum       string `json:"sha256"`
+}
+
+// Backup writes the stored documents to w as JSON lines, one document per
+// line in canonical Extended JSON along with its checksum, followed by a
+// trailer holding the number of documents and a checksum of the whole
+// backup. Unlike ExportPolicyCSV, it keeps every stored field, such as
+// metadata, timestamps and encrypted values. The documents are streamed from
+// the server, so the policy is never held in memory as a whole. See Restore.
+func (a *Adapter) Backup(w io.Writer) error {
+	return a.BackupCtx(context.Background(), w)
+}
+
+// BackupCtx is like Backup but honors the deadline and cancellation of ctx.
+func (a *Adapter) BackupCtx(ctx context.Context, w io.Writer) (err error) {
+	ctx, end := a.begin(ctx, "Backup")
+	defer func() { err = end(err) }()
+
+	selector := a.scope(bson.M{})
+	var cursor *mongo.Cursor
+	err = a.retry(ctx, func(ctx context.Context) error {
+		var err error
+		cursor, err = a.loads.Find(ctx, selector, a.findOptions())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	// The checksums cover the documents as marshaled, so they must be
+	// written unchanged.
+	enc.SetEscapeHTML(false)
+	total := sha256.New()
+	n := 0
+	for cursor.Next(ctx) {
+		doc, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return err
+		}
+		sum := checksum(total, doc)
+		if err := enc.Encode(backupLine{Doc: doc, Sum: sum}); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	observeQuery(ctx, selector, int64(n))
+
+	if err := enc.Encode(backupTrailer{Documents: n, Sum: hex.EncodeToString(total.Sum(nil))}); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// checksum returns the SHA-256 checksum of doc and adds it to total.
+func checksum(total hash.Hash, doc []byte) string {
+	s := sha256.Sum256(doc)
+	sum := hex.EncodeToString(s[:])
+	total.Write([]byte(sum))
+	return sum
+}
+
+// Restore replaces the stored rules with the documents of a backup written
+// by Backup. The backup is read and its checksums are verified in full
+// before anything is written, so a corrupt or truncated backup leaves the
+// stored rules untouched. The documents are stored as they were backed up,
+// except for their _id, which the server assigns anew. A view for a tenant,
+// see WithTenant, replaces only the rules of its tenant and stores the
+// documents with its tenant, so a backup of one tenant may be restored into
+// another. With WithTransactions, the stored rules are replaced atomically.
+// Enforcers using the adapter must reload the policy.
+func (a *Adapter) Restore(r io.Reader) error {
+	return a.RestoreCtx(context.Background(), r)
+}
+
+// RestoreCtx is like Restore but honors the deadline and cancellation of ctx.
+func (a *Adapter) RestoreCtx(ctx context.Context, r io.Reader) (err error) {
+	ctx, end := a.begin(ctx, "Restore")
+	defer func() { err = end(err) }()
+
+	docs, err := readBackup(r)
+	if err != nil {
+		return err
+	}
+	if a.tenant != "" {
+		for i, doc := range docs {
+			docs[i] = a.stampTenant(doc.(bson.D))
+		}
+	}
+
+	return a.withHistory(ctx, change{op: "restore"}, func(ctx context.Context) error {
+		if err := a.deleteMany(ctx, a.scope(bson.M{})); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+		return a.insertMany(ctx, a.collection, docs)
+	})
+}
+
+// stampTenant returns doc with its tenant replaced by the tenant of a.
+func (a *Adapter) stampTenant(doc bson.D) bson.D {
+	for i, field := range doc {
+		if field.Key == a.schema.Tenant {
+			doc[i].Value = a.tenant
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: a.schema.Tenant, Value: a.tenant})
+}
+
+// readBackup reads and verifies the documents of a backup.
+func readBackup(r io.Reader) ([]interface{}, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	total := sha256.New()
+
+	var docs []interface{}
+	for scanner.Scan() {
+		var line backupLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, errors.New("corrupt backup at line " + strconv.Itoa(len(docs)+1) + ": " + err.Error())
+		}
+
+		if line.Doc == nil {
+			var trailer backupTrailer
+			if err := json.Unmarshal(scanner.Bytes(), &trailer); err != nil {
+				return nil, errors.New("corrupt backup trailer: " + err.Error())
+			}
+			if trailer.Documents != len(docs) || trailer.Sum != hex.EncodeToString(total.Sum(nil)) {
+				return nil, errors.New("corrupt backup: checksum mismatch")
+			}
+			if scanner.Scan() {
+				return nil, errors.New("corrupt backup: data after the trailer")
+			}
+			return docs, scanner.Err()
+		}
+
+		if checksum(total, line.Doc) != line.Sum {
+			return nil, errors.New("corrupt backup: checksum mismatch at line " + strconv.Itoa(len(docs)+1))
+		}
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(line.Doc, true, &doc); err != nil {
+			return nil, errors.New("corrupt backup at line " + strconv.Itoa(len(docs)+1) + ": " + err.Error())
+		}
+		fields := doc[:0]
+		for _, field := range doc {
+			if field.Key != "_id" {
+				fields = append(fields, field)
+			}
+		}
+		docs = append(docs, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("corrupt backup: missing trailer")
+}
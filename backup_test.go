@@ -0,0 +1,106 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAdapterBackupRestore(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_backup", WithMetadata())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	// Characters JSON may escape for HTML survive the checksums.
+	if err := a.AddPolicy("p", "p", []string{"carol", "/a?x=1&y=<2>", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	var backup bytes.Buffer
+	if err := a.Backup(&backup); err != nil {
+		t.Fatalf("Expected Backup() to be successful; got %v", err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(backup.String(), "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("Expected 6 documents and a trailer; got %d lines", len(lines))
+	}
+
+	if _, err := e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatalf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+
+	// Neither a changed nor a truncated backup is restored.
+	corrupt := strings.Replace(backup.String(), "data2_admin", "data3_admin", 1)
+	if err := a.Restore(strings.NewReader(corrupt)); err == nil {
+		t.Errorf("Expected Restore() to fail for a changed backup")
+	}
+	truncated := strings.Join(lines[:6], "")
+	if err := a.Restore(strings.NewReader(truncated)); err == nil {
+		t.Errorf("Expected Restore() to fail for a truncated backup")
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "/a?x=1&y=<2>", "read"}})
+
+	if err := a.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Expected Restore() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "/a?x=1&y=<2>", "read"}})
+}
+
+func TestRestoreAcrossTenants(t *testing.T) {
+	acme := newTestAdapter(t, "casbin_rule_backup_tenants", WithTenant("acme"))
+	globex := acme.WithTenant("globex")
+
+	if err := acme.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := globex.AddPolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	var backup bytes.Buffer
+	if err := acme.Backup(&backup); err != nil {
+		t.Fatalf("Expected Backup() to be successful; got %v", err)
+	}
+
+	// Restoring acme's backup into globex replaces globex's rules with
+	// copies owned by globex and leaves acme's rules alone.
+	if err := globex.Restore(bytes.NewReader(backup.Bytes())); err != nil {
+		t.Fatalf("Expected Restore() to be successful; got %v", err)
+	}
+	e1 := newEnforcer(t, "examples/rbac_model.conf", acme)
+	testGetPolicy(t, e1, [][]string{{"alice", "data1", "read"}})
+	e2 := newEnforcer(t, "examples/rbac_model.conf", globex)
+	testGetPolicy(t, e2, [][]string{{"alice", "data1", "read"}})
+
+	if err := acme.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	if err := e2.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e2, [][]string{{"alice", "data1", "read"}})
+}
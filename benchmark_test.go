@@ -0,0 +1,132 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// Start a server for the benchmarks with docker-compose.yml and run them with
+//
+//	go test -run '^$' -bench . -benchtime 10x
+//
+// The largest policies are skipped with -short.
+
+// benchmarkSizes are the numbers of rules of the policies loaded and saved.
+var benchmarkSizes = []struct {
+	name  string
+	rules int
+}{
+	{"10k", 10000},
+	{"100k", 100000},
+	{"1M", 1000000},
+}
+
+// benchmarkModel returns a model holding the given number of policy rules.
+func benchmarkModel(b *testing.B, rules int) model.Model {
+	m := newModel(b, "examples/rbac_model.conf")
+	for i := 0; i < rules; i++ {
+		m.AddPolicy("p", "p", []string{"user" + strconv.Itoa(i), "data" + strconv.Itoa(i%100), "read"})
+	}
+	return m
+}
+
+// benchmarkAdapter returns an adapter of an empty collection, which is
+// dropped when the benchmark is done.
+func benchmarkAdapter(b *testing.B, opts ...Option) *Adapter {
+	a, err := NewAdapterWithError(getDbURL(), append([]Option{WithCollection("casbin_rule_benchmark")}, opts...)...)
+	if err != nil {
+		b.Fatalf("Expected NewAdapterWithError() to be successful; got %v", err)
+	}
+	if err := a.dropTable(context.Background()); err != nil {
+		b.Fatalf("Expected dropTable() to be successful; got %v", err)
+	}
+	b.Cleanup(func() {
+		a.dropTable(context.Background())
+		a.Close()
+	})
+	return a
+}
+
+func BenchmarkLoadPolicy(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(size.name, func(b *testing.B) {
+			if testing.Short() && size.rules > 100000 {
+				b.Skip("skipping the largest policy in short mode")
+			}
+			a := benchmarkAdapter(b)
+			if err := a.SavePolicy(benchmarkModel(b, size.rules)); err != nil {
+				b.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				m := newModel(b, "examples/rbac_model.conf")
+				b.StartTimer()
+				if err := a.LoadPolicy(m); err != nil {
+					b.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+				}
+			}
+			b.ReportMetric(float64(size.rules)*float64(b.N)/b.Elapsed().Seconds(), "rules/s")
+		})
+	}
+}
+
+func BenchmarkSavePolicy(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(size.name, func(b *testing.B) {
+			if testing.Short() && size.rules > 100000 {
+				b.Skip("skipping the largest policy in short mode")
+			}
+			a := benchmarkAdapter(b)
+			m := benchmarkModel(b, size.rules)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := a.SavePolicy(m); err != nil {
+					b.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+				}
+			}
+			b.ReportMetric(float64(size.rules)*float64(b.N)/b.Elapsed().Seconds(), "rules/s")
+		})
+	}
+}
+
+func BenchmarkAddPolicy(b *testing.B) {
+	a := benchmarkAdapter(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.AddPolicy("p", "p", []string{"user" + strconv.Itoa(i), "data1", "read"}); err != nil {
+			b.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+		}
+	}
+}
+
+func BenchmarkAddPolicyUnique(b *testing.B) {
+	a := benchmarkAdapter(b, WithDuplicates(DuplicatesReject))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := a.AddPolicy("p", "p", []string{"user" + strconv.Itoa(i), "data1", "read"}); err != nil {
+			b.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// circuitBreaker fails operations fast while the server is down, see
+// WithCircuitBreaker. It opens after threshold consecutive operations failed
+// for want of the server, and once cooldown has passed lets a single
+// operation through to probe whether the server is back.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	// openedAt is the time the circuit opened, or zero while it is closed.
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether an operation may reach the server.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the result of an operation that was allowed. Any result but
+// an outage shows that the server is reachable, and closes the circuit.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isOutage(err) {
+		b.failures = 0
+		b.openedAt = time.Time{}
+		b.probing = false
+		return
+	}
+
+	b.failures++
+	if b.probing || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// isOutage reports whether an operation failed because the server could not
+// be reached or did not answer in time.
+func isOutage(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, context.DeadlineExceeded) || isTransient(err)
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAdapterWithCircuitBreaker(t *testing.T) {
+	// Nothing listens on port 1, and the driver connects lazily.
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected mongo.Connect() to be successful; got %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	a, err := NewAdapterWithClient(client, "casbin", WithIndexCreation(IndexCreationDisabled), WithCircuitBreaker(2, 200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected NewAdapterWithClient() to be successful; got %v", err)
+	}
+
+	rule := []string{"alice", "data1", "read"}
+	for i := 0; i < 2; i++ {
+		if err := a.AddPolicy("p", "p", rule); !errors.Is(err, ErrNotConnected) {
+			t.Errorf("Expected AddPolicy() to fail with ErrNotConnected; got %v", err)
+		}
+	}
+
+	// The circuit is open.
+	start := time.Now()
+	if err := a.AddPolicy("p", "p", rule); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected AddPolicy() to fail with ErrCircuitOpen; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected AddPolicy() to fail fast; took %v", elapsed)
+	}
+
+	// After the cooldown, an operation probes the server again.
+	time.Sleep(200 * time.Millisecond)
+	if err := a.AddPolicy("p", "p", rule); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected AddPolicy() to probe the server; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", rule); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected AddPolicy() to fail with ErrCircuitOpen after a failed probe; got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// insertMany inserts documents into the collection, in chunks of the size set
+// by WithInsertBatchSize, several at once as set by WithInsertConcurrency.
+// Documents are inserted unordered, so a failed document does not keep the
+// others from being inserted. Inside a transaction, chunks are inserted one
+// after the other.
+func (a *Adapter) insertMany(ctx context.Context, collection *mongo.Collection, docs []interface{}) error {
+	size := a.insertBatch
+	if size <= 0 || size > len(docs) {
+		size = len(docs)
+	}
+	var chunks [][]interface{}
+	for i := 0; i < len(docs); i += size {
+		end := i + size
+		if end > len(docs) {
+			end = len(docs)
+		}
+		chunks = append(chunks, docs[i:end])
+	}
+
+	workers := a.insertWorkers
+	if workers < 1 || mongo.SessionFromContext(ctx) != nil {
+		workers = 1
+	}
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	opts := options.InsertMany().SetOrdered(false)
+	insert := func(ctx context.Context, chunk []interface{}) error {
+		res, err := collection.InsertMany(ctx, chunk, opts)
+		if err != nil {
+			return err
+		}
+		a.debug("inserted rules", "collection", collection.Name(), "count", len(res.InsertedIDs))
+		observeQuery(ctx, nil, int64(len(res.InsertedIDs)))
+		return nil
+	}
+
+	if workers <= 1 {
+		for _, chunk := range chunks {
+			if err := insert(ctx, chunk); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The first error stops the chunks that have not started yet.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	queue := make(chan []interface{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range queue {
+				if err := insert(runCtx, chunk); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		if runCtx.Err() != nil {
+			break
+		}
+		queue <- chunk
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil {
+		// Chunks may have been skipped because ctx was canceled.
+		return ctx.Err()
+	}
+	return firstErr
+}
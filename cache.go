@@ -0,0 +1,89 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"sync"
+	"time"
+)
+
+// policyCache holds the rules read by the last full load of the policy, see
+// WithCache. An adapter shares its cache with its views, which keep the rules
+// of each tenant apart, so that a change through any of them, or reported to
+// a Watcher, invalidates the rules cached for all.
+type policyCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation is incremented on every invalidation, so a load that raced
+	// with a write does not store what it read.
+	generation uint64
+}
+
+// cacheEntry holds the rules of one tenant.
+type cacheEntry struct {
+	lines  []CasbinRule
+	loaded time.Time
+}
+
+func newPolicyCache(ttl time.Duration) *policyCache {
+	return &policyCache{ttl: ttl, entries: map[string]cacheEntry{}}
+}
+
+// get returns the cached rules of the tenant if they are fresh. Otherwise it
+// returns the generation to pass to set after loading the rules from the
+// database.
+func (c *policyCache) get(tenant string) ([]CasbinRule, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[tenant]; ok && time.Since(e.loaded) < c.ttl {
+		return e.lines, c.generation, true
+	}
+	return nil, c.generation, false
+}
+
+// set stores the loaded rules of the tenant, unless the cache was
+// invalidated since the load started.
+func (c *policyCache) set(tenant string, lines []CasbinRule, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.entries[tenant] = cacheEntry{lines: lines, loaded: time.Now()}
+}
+
+// invalidate drops the cached rules of all tenants.
+func (c *policyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]cacheEntry{}
+	c.generation++
+}
+
+// InvalidateCache drops the policy cached by the adapter and its views, so
+// the next LoadPolicy reads it from the database. Writes through the adapter
+// and changes reported to a Watcher created for it invalidate the cache
+// already; call InvalidateCache when the policy may have been changed
+// otherwise.
+func (a *Adapter) InvalidateCache() {
+	if a.cache != nil {
+		a.cache.invalidate()
+	}
+}
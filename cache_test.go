@@ -0,0 +1,75 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCache(t *testing.T) {
+	initPolicy(t)
+
+	a := newTestAdapter(t, defaultCollectionName, WithCache(time.Minute))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+
+	// A change behind the adapter's back is not seen while the cache is fresh.
+	if _, err := a.collection.DeleteMany(context.Background(), bson.M{"v0": "alice"}); err != nil {
+		t.Fatalf("Expected DeleteMany() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	a.InvalidateCache()
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// Writes through the adapter invalidate the cache.
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+}
+
+func TestCacheSharedByViews(t *testing.T) {
+	a, err := newAdapter([]Option{WithCache(time.Minute)})
+	if err != nil {
+		t.Fatalf("Expected newAdapter() to be successful; got %v", err)
+	}
+	acme, globex := a.WithTenant("acme"), a.WithTenant("globex")
+
+	_, generation, _ := acme.cache.get("acme")
+	acme.cache.set("acme", []CasbinRule{{PType: "p", V0: "alice"}}, generation)
+	if _, _, ok := globex.cache.get("globex"); ok {
+		t.Errorf("Expected the rules of acme not to be cached for globex")
+	}
+
+	// Invalidating through one adapter drops the rules cached for all.
+	globex.InvalidateCache()
+	if _, _, ok := acme.cache.get("acme"); ok {
+		t.Errorf("Expected the cache of the view to be invalidated")
+	}
+}
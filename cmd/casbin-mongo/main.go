@@ -0,0 +1,229 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command casbin-mongo administers a Casbin policy stored in MongoDB by the
+// mongodb-adapter.
+//
+// Usage:
+//
+//	casbin-mongo [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	list [ptype]              print the stored rules, of one policy type or all
+//	add <ptype> <value>...    add a rule
+//	remove <ptype> <value>... remove a rule
+//	import [-replace] <file>  add the rules of a policy file, or replace the
+//	                          stored rules with them
+//	export [file]             write the stored rules as a policy file, to
+//	                          standard output if file is omitted
+//	validate <model.conf>     check the stored rules against a model
+//
+// The flags are:
+//
+//	-url string         MongoDB URL (default $CASBIN_MONGO_URL or 127.0.0.1:27017)
+//	-database string    database holding the policy (default "casbin")
+//	-collection string  collection holding the policy (default "casbin_rule")
+//	-tenant string      tenant whose rules are administered
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	mongodbadapter "github.com/casbin/mongodb-adapter/v2"
+)
+
+// errUsage reports wrong arguments, after which the usage is printed.
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	url := os.Getenv("CASBIN_MONGO_URL")
+	if url == "" {
+		url = "127.0.0.1:27017"
+	}
+
+	flags := flag.NewFlagSet("casbin-mongo", flag.ExitOnError)
+	flags.StringVar(&url, "url", url, "MongoDB URL")
+	database := flags.String("database", "casbin", "database holding the policy")
+	collection := flags.String("collection", "casbin_rule", "collection holding the policy")
+	tenant := flags.String("tenant", "", "tenant whose rules are administered")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: casbin-mongo [flags] list|add|remove|import|export|validate [arguments]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	a, err := mongodbadapter.NewAdapterWithError(url,
+		mongodbadapter.WithDatabase(*database),
+		mongodbadapter.WithCollection(*collection),
+		mongodbadapter.WithIndexCreation(mongodbadapter.IndexCreationBestEffort))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "casbin-mongo:", err)
+		os.Exit(1)
+	}
+	defer a.Close()
+	if *tenant != "" {
+		a = a.WithTenant(*tenant)
+	}
+
+	err = run(a, flags.Arg(0), flags.Args()[1:])
+	if err == errUsage {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "casbin-mongo:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command with its arguments.
+func run(a *mongodbadapter.Adapter, command string, args []string) error {
+	switch command {
+	case "list":
+		if len(args) > 1 {
+			return errUsage
+		}
+		return list(a, args)
+	case "add", "remove":
+		if len(args) < 2 || args[0] == "" {
+			return errUsage
+		}
+		ptype, rule := args[0], args[1:]
+		if command == "add" {
+			return a.AddPolicy(ptype[:1], ptype, rule)
+		}
+		return a.RemovePolicy(ptype[:1], ptype, rule)
+	case "import":
+		return importFile(a, args)
+	case "export":
+		return exportFile(a, args)
+	case "validate":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return validate(a, args[0])
+	default:
+		return errUsage
+	}
+}
+
+// list prints the stored rules of the policy type in args, or all of them.
+func list(a *mongodbadapter.Adapter, args []string) error {
+	return a.LoadPolicyStream(func(ptype string, rule []string) error {
+		if len(args) == 1 && ptype != args[0] {
+			return nil
+		}
+		_, err := fmt.Println(strings.Join(append([]string{ptype}, rule...), ", "))
+		return err
+	})
+}
+
+// importFile imports the policy file in args.
+func importFile(a *mongodbadapter.Adapter, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	replace := flags.Bool("replace", false, "replace the stored rules")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mode := mongodbadapter.ImportAppend
+	if *replace {
+		mode = mongodbadapter.ImportReplace
+	}
+	return a.ImportPolicyCSV(f, mode)
+}
+
+// exportFile exports the stored rules to the file in args, or to standard
+// output.
+func exportFile(a *mongodbadapter.Adapter, args []string) error {
+	var w io.Writer = os.Stdout
+	switch len(args) {
+	case 0:
+	case 1:
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	default:
+		return errUsage
+	}
+	return a.ExportPolicyCSV(w)
+}
+
+// validate checks that each stored rule has a policy type defined by the
+// model in path, and as many values as the definition.
+func validate(a *mongodbadapter.Adapter, path string) error {
+	m, err := model.NewModelFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	err = a.LoadPolicyStream(func(ptype string, rule []string) error {
+		if problem := check(m, ptype, rule); problem != "" {
+			invalid++
+			fmt.Printf("%s: %s\n", strings.Join(append([]string{ptype}, rule...), ", "), problem)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if invalid > 0 {
+		return errors.New(strconv.Itoa(invalid) + " invalid rules")
+	}
+	return nil
+}
+
+// check returns what is wrong with the rule, or "" if it is valid.
+func check(m model.Model, ptype string, rule []string) string {
+	if ptype == "" {
+		return "missing policy type"
+	}
+	ast, ok := m[ptype[:1]][ptype]
+	if !ok {
+		return "policy type not defined by the model"
+	}
+
+	want := len(ast.Tokens)
+	if ptype[:1] == "g" {
+		// Role definitions are written as "_, _" or "_, _, _".
+		want = strings.Count(ast.Value, "_")
+	}
+	if len(rule) != want {
+		return "expected " + strconv.Itoa(want) + " values, got " + strconv.Itoa(len(rule))
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// compatibility selects the workarounds for a server that implements the
+// MongoDB API only in part.
+type compatibility int
+
+const (
+	compatMongoDB compatibility = iota
+	compatCosmosDB
+	compatDocumentDB
+)
+
+const (
+	// cosmosThrottled is the error code of Cosmos DB for a request that
+	// exceeded the provisioned throughput.
+	cosmosThrottled = 16500
+	// cosmosRetryAttempts and cosmosRetryBackoff apply to throttled requests
+	// unless WithRetry is given.
+	cosmosRetryAttempts = 5
+	cosmosRetryBackoff  = 100 * time.Millisecond
+)
+
+// retryAfterPattern finds the delay Cosmos DB asks for in the message of a
+// throttling error.
+var retryAfterPattern = regexp.MustCompile(`RetryAfterMs=(\d+)`)
+
+// WithCosmosDB adapts the adapter to the MongoDB API of Azure Cosmos DB:
+//
+//   - Requests throttled for exceeding the provisioned throughput (error
+//     16500) are retried after the delay the server asks for, five times in
+//     total unless WithRetry says otherwise. A throttled request is rejected
+//     before it is applied, so without WithTransactions, single rules added
+//     and rules added with DuplicatesIgnore are retried too; other writes
+//     are only retried with WithTransactions.
+//   - Indexes are created one at a time, and an index the server rejects is
+//     skipped. A rejected unique index is still an error, as Cosmos DB only
+//     creates unique indexes on empty collections.
+//   - SavePolicy replaces the documents in place, as collections cannot be
+//     renamed.
+func WithCosmosDB() Option {
+	return func(a *Adapter) error {
+		a.compat = compatCosmosDB
+		return nil
+	}
+}
+
+// WithDocumentDB adapts the adapter to Amazon DocumentDB:
+//
+//   - The connection uses TLS, with the server certificate verified against
+//     the PEM encoded CA bundle in caFile, such as the global-bundle.pem
+//     published by AWS. If caFile is empty, TLS must be configured in the URL
+//     or with WithTLSConfig.
+//   - Retryable writes are turned off, as DocumentDB does not support them.
+//   - Indexes are created one at a time, and an index the server rejects is
+//     skipped, except for unique ones.
+//
+// Older versions of DocumentDB do not support change streams, or only once
+// they are enabled on the cluster; NewWatcher then fails with
+// ErrChangeStreamsUnsupported.
+func WithDocumentDB(caFile string) Option {
+	return func(a *Adapter) error {
+		a.compat = compatDocumentDB
+		a.clientOptions = append(a.clientOptions, options.Client().SetRetryWrites(false))
+		if caFile == "" {
+			return nil
+		}
+		return WithTLSFiles(caFile, "", "")(a)
+	}
+}
+
+// isThrottled reports whether Cosmos DB rejected a request for exceeding
+// the provisioned throughput.
+func isThrottled(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(cosmosThrottled)
+}
+
+// retryAfter returns the delay a throttled request asks for, if it does.
+func retryAfter(err error) (time.Duration, bool) {
+	m := retryAfterPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, false
+	}
+	ms, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// createIndexesSeparately creates the indexes one at a time, skipping those
+// the server rejects, except for unique ones. Servers that implement the
+// MongoDB API in part support fewer index options.
+func (a *Adapter) createIndexesSeparately(ctx context.Context, collection *mongo.Collection, models []mongo.IndexModel) error {
+	for _, model := range models {
+		_, err := collection.Indexes().CreateOne(ctx, model)
+		if err == nil {
+			continue
+		}
+
+		var serverErr mongo.ServerError
+		unique := model.Options != nil && model.Options.Unique != nil && *model.Options.Unique
+		if unique || !errors.As(err, &serverErr) {
+			return err
+		}
+		a.debug("skipping rejected index", "collection", collection.Name(), "keys", model.Keys, "error", err)
+	}
+	return nil
+}
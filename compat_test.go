@@ -0,0 +1,64 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRetryAfter(t *testing.T) {
+	err := mongo.CommandError{Code: 16500, Name: "TooManyRequests", Message: "Request rate is large. RetryAfterMs=25, Details='Response status code does not indicate success'"}
+	if !isThrottled(err) {
+		t.Error("Expected error 16500 to be throttling")
+	}
+	if after, ok := retryAfter(err); !ok || after != 25*time.Millisecond {
+		t.Errorf("Expected a delay of 25ms; got %v, %v", after, ok)
+	}
+	if _, ok := retryAfter(mongo.CommandError{Code: 16500, Message: "Request rate is large"}); ok {
+		t.Error("Expected no delay without RetryAfterMs")
+	}
+}
+
+func TestCosmosDBRetry(t *testing.T) {
+	a, err := newAdapter([]Option{WithCosmosDB()})
+	if err != nil {
+		t.Fatalf("Expected newAdapter() to be successful; got %v", err)
+	}
+
+	calls := 0
+	err = a.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return mongo.CommandError{Code: 16500, Message: "Request rate is large. RetryAfterMs=1"}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected throttled requests to be retried; got %d attempts, %v", calls, err)
+	}
+
+	calls = 0
+	err = a.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected other errors not to be retried without WithRetry; got %d attempts", calls)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestConcurrentUse(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_concurrent", WithPoolSize(1, 20))
+
+	const n = 50
+	// Each load fills its own model.
+	models := make([]model.Model, n)
+	for i := range models {
+		models[i] = newModel(t, "examples/rbac_model.conf")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			errs <- a.AddPolicy("p", "p", []string{"user" + strconv.Itoa(i), "data1", "read"})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			errs <- a.LoadFilteredPolicy(models[i], &Filter{V1: []string{"data1"}})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Expected concurrent calls to be successful; got %v", err)
+		}
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	if policy, _ := e.GetPolicy(); len(policy) != n {
+		t.Errorf("Expected %d rules; got %d", n, len(policy))
+	}
+	if a.IsFiltered() {
+		t.Error("Expected the full load to reset IsFiltered()")
+	}
+}
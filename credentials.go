@@ -0,0 +1,84 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RefreshCredentials replaces the username and password the adapter
+// authenticates with, such as short-lived credentials issued by Vault, without
+// recreating the adapter. It connects anew with the new credentials and only
+// if that succeeds moves the adapter to the new connection, waiting for the
+// operations in progress, and closes the old one. The authentication
+// mechanism and source stay as set by the URL or WithCredential.
+//
+// A Watcher of the adapter and views created with WithTenant carry on over
+// the new connection.
+// The credentials of a client passed to NewAdapterWithClient belong to the
+// caller and cannot be refreshed.
+func (a *Adapter) RefreshCredentials(username, password string) error {
+	return a.RefreshCredentialsCtx(context.Background(), username, password)
+}
+
+// RefreshCredentialsCtx is like RefreshCredentials but honors the deadline and cancellation of ctx.
+func (a *Adapter) RefreshCredentialsCtx(ctx context.Context, username, password string) error {
+	if !a.ownsClient {
+		return errors.New("cannot refresh the credentials of a client passed to NewAdapterWithClient")
+	}
+
+	cred := options.Credential{}
+	if a.credential != nil {
+		cred = *a.credential
+	} else if uri := options.Client().ApplyURI(connectionString(a.url)); uri.Auth != nil {
+		cred = *uri.Auth
+	}
+	cred.Username = username
+	cred.Password = password
+	cred.PasswordSet = true
+
+	client, err := a.dial(ctx, &cred)
+	if err != nil {
+		return classify(err)
+	}
+
+	old := a.swapClient(client, &cred)
+	a.debug("refreshed credentials", "username", username)
+	return old.Disconnect(ctx)
+}
+
+// swapClient moves the adapter to the client once no operation is in
+// progress, and returns the previous client.
+func (a *Adapter) swapClient(client *mongo.Client, cred *options.Credential) *mongo.Client {
+	a.connMu.Lock()
+	defer a.connMu.Unlock()
+
+	old := a.client
+	a.client = client
+	a.credential = cred
+	a.selectCollections()
+	return old
+}
+
+// current returns the policy collection, for use outside of an operation.
+func (a *Adapter) current() *mongo.Collection {
+	a.connMu.RLock()
+	defer a.connMu.RUnlock()
+	return a.collection
+}
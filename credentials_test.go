@@ -0,0 +1,56 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRefreshCredentials(t *testing.T) {
+	root := newTestAdapter(t, "casbin_rule_credentials")
+
+	admin := root.client.Database("admin")
+	err := admin.RunCommand(context.Background(), bson.D{
+		{Key: "createUser", Value: "casbin_rotated"},
+		{Key: "pwd", Value: "secret1"},
+		{Key: "roles", Value: bson.A{bson.M{"role": "readWrite", "db": root.databaseName}}},
+	}).Err()
+	if err != nil {
+		t.Skipf("Cannot create a user: %v", err)
+	}
+	defer admin.RunCommand(context.Background(), bson.D{{Key: "dropUser", Value: "casbin_rotated"}})
+
+	a := newTestAdapter(t, "casbin_rule_credentials")
+	defer a.Close()
+
+	if err := a.RefreshCredentials("casbin_rotated", "wrong"); err == nil {
+		t.Error("Expected RefreshCredentials() to fail with a wrong password")
+	}
+	if err := a.RefreshCredentials("casbin_rotated", "secret1"); err != nil {
+		t.Errorf("Expected RefreshCredentials() to be successful; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+}
@@ -0,0 +1,233 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ImportMode controls how ImportPolicyCSV treats the rules stored already.
+type ImportMode int
+
+const (
+	// ImportAppend adds the imported rules to the stored ones. Rules that are
+	// stored already are handled according to the DuplicateMode, see
+	// WithDuplicates.
+	ImportAppend ImportMode = iota
+	// ImportReplace replaces the stored rules with the imported ones.
+	ImportReplace
+)
+
+// ExportPolicyCSV writes the stored rules to w in the format of a Casbin
+// policy file, one rule per line, such as "p, alice, data1, read". Values
+// containing a comma or a double quote are quoted. The rules are streamed
+// from the server, so the policy is never held in memory as a whole.
+func (a *Adapter) ExportPolicyCSV(w io.Writer) error {
+	return a.ExportPolicyCSVCtx(context.Background(), w)
+}
+
+// ExportPolicyCSVCtx is like ExportPolicyCSV but honors the deadline and cancellation of ctx.
+func (a *Adapter) ExportPolicyCSVCtx(ctx context.Context, w io.Writer) (err error) {
+	ctx, end := a.begin(ctx, "ExportPolicyCSV")
+	defer func() { err = end(err) }()
+
+	buf := bufio.NewWriter(w)
+	_, err = a.forEachLine(ctx, a.loads, a.scope(bson.M{}), func(line CasbinRule) error {
+		_, err := buf.WriteString(csvLine(line.PType, line.toStringPolicy()))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// csvLine formats a rule as a line of a policy file.
+func csvLine(ptype string, rule []string) string {
+	fields := make([]string, 0, len(rule)+1)
+	fields = append(fields, ptype)
+	for _, v := range rule {
+		if strings.ContainsAny(v, ",\"\n") || strings.TrimSpace(v) != v {
+			v = `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+		}
+		fields = append(fields, v)
+	}
+	return strings.Join(fields, ", ") + "\n"
+}
+
+// ImportPolicyCSV reads rules in the format of a Casbin policy file from r
+// and stores them without going through an enforcer, for example to migrate
+// from the file adapter. Empty lines and lines starting with "#" are skipped.
+// The file is read in full before anything is written, so a malformed file
+// leaves the stored rules untouched. Enforcers using the adapter must reload
+// the policy.
+func (a *Adapter) ImportPolicyCSV(r io.Reader, mode ImportMode) error {
+	return a.ImportPolicyCSVCtx(context.Background(), r, mode)
+}
+
+// ImportPolicyCSVCtx is like ImportPolicyCSV but honors the deadline and cancellation of ctx.
+func (a *Adapter) ImportPolicyCSVCtx(ctx context.Context, r io.Reader, mode ImportMode) (err error) {
+	ctx, end := a.begin(ctx, "ImportPolicyCSV")
+	defer func() { err = end(err) }()
+
+	if mode != ImportAppend && mode != ImportReplace {
+		return errors.New("unknown import mode")
+	}
+
+	var lines []CasbinRule
+	err = readCSV(r, func(ptype string, rule []string) error {
+		line := a.ruleLine(ptype, rule)
+		lines = append(lines, line)
+		return a.validateRule(line.PType, line.toStringPolicy())
+	})
+	if err != nil {
+		return err
+	}
+
+	c := change{op: "import"}
+	if mode == ImportReplace {
+		if err := a.checkUnscoped(ctx, "replace"); err != nil {
+			return err
+		}
+		return a.withHistory(ctx, c, func(ctx context.Context) error {
+			return a.replaceLines(ctx, a.scope(bson.M{}), false, lines)
+		})
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+	if a.duplicates == DuplicatesIgnore {
+		models := make([]mongo.WriteModel, 0, len(lines))
+		for _, line := range lines {
+			models = append(models, a.upsertModel(line))
+		}
+		return a.withHistory(ctx, c, func(ctx context.Context) error {
+			return a.bulkWrite(ctx, models)
+		})
+	}
+
+	docs := make([]interface{}, 0, len(lines))
+	for _, line := range lines {
+		docs = append(docs, a.document(line))
+	}
+	return a.withHistory(ctx, c, func(ctx context.Context) error {
+		return a.insertMany(ctx, a.collection, docs)
+	})
+}
+
+// readCSV parses the rules of a policy file, calling fn for each with its
+// values as read; rule is only valid until fn returns. Whitespace around
+// unquoted values is dropped, while quoted values are kept as they are, see
+// csvLine.
+func readCSV(r io.Reader, fn func(ptype string, rule []string) error) error {
+	raw := &rawLines{r: r, first: 1}
+	reader := csv.NewReader(raw)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := range record {
+			if line, col := reader.FieldPos(i); raw.at(line, col) != '"' {
+				record[i] = strings.TrimSpace(record[i])
+			}
+		}
+		last, _ := reader.FieldPos(len(record) - 1)
+		raw.discard(last)
+		if len(record) == 1 && record[0] == "" {
+			continue
+		}
+		if record[0] == "" {
+			line, _ := reader.FieldPos(0)
+			return errors.New("missing policy type in line " + strconv.Itoa(line))
+		}
+		if err := fn(record[0], record[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+// rawLines keeps the lines of a policy file the CSV reader reads through it,
+// until they are discarded, so that quoted values can be told from unquoted
+// ones.
+type rawLines struct {
+	r       io.Reader
+	lines   [][]byte
+	first   int
+	partial []byte
+}
+
+func (l *rawLines) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	data := p[:n]
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			l.partial = append(l.partial, data...)
+			break
+		}
+		l.lines = append(l.lines, append(l.partial, data[:i]...))
+		l.partial = nil
+		data = data[i+1:]
+	}
+	if err == io.EOF && l.partial != nil {
+		l.lines = append(l.lines, l.partial)
+		l.partial = nil
+	}
+	return n, err
+}
+
+// at returns the byte at the line and column, both counted from 1, or 0 if
+// there is none.
+func (l *rawLines) at(line, col int) byte {
+	i := line - l.first
+	if i < 0 || i >= len(l.lines) || col < 1 || col > len(l.lines[i]) {
+		return 0
+	}
+	return l.lines[i][col-1]
+}
+
+// discard drops the lines up to and including line.
+func (l *rawLines) discard(line int) {
+	n := line - l.first + 1
+	if n <= 0 {
+		return
+	}
+	if n > len(l.lines) {
+		n = len(l.lines)
+	}
+	l.lines = l.lines[n:]
+	l.first += n
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// sortedLines returns the non-empty lines of s in sorted order.
+func sortedLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestExportPolicyCSV(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_csv")
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"carol", "a, b", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := a.ExportPolicyCSV(&buf); err != nil {
+		t.Fatalf("Expected ExportPolicyCSV() to be successful; got %v", err)
+	}
+
+	file, err := ioutil.ReadFile("examples/rbac_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sortedLines(string(file) + "\np, carol, \"a, b\", read")
+	if got := sortedLines(buf.String()); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the policy file\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestImportPolicyCSV(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_csv")
+
+	if err := a.AddPolicy("p", "p", []string{"mallory", "data1", "write"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	f, err := os.Open("examples/rbac_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := a.ImportPolicyCSV(f, ImportReplace); err != nil {
+		t.Fatalf("Expected ImportPolicyCSV() to be successful; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	file := "# added later\n\np, carol, \"a, b\", read\n"
+	if err := a.ImportPolicyCSV(strings.NewReader(file), ImportAppend); err != nil {
+		t.Fatalf("Expected ImportPolicyCSV() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "a, b", "read"}})
+
+	// A malformed file leaves the policy alone.
+	if err := a.ImportPolicyCSV(strings.NewReader("p, dave, data1, read\n, eve, data2, read\n"), ImportReplace); err == nil {
+		t.Errorf("Expected ImportPolicyCSV() to fail for a missing policy type")
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	if policy, _ := e.GetPolicy(); len(policy) != 5 {
+		t.Errorf("Expected the policy to be unchanged; got %v", policy)
+	}
+}
+
+func TestReadCSVKeepsQuotedWhitespace(t *testing.T) {
+	file := csvLine("p", []string{" alice", "data1 ", "read"}) + "p,  bob , data2 ,write\n"
+	var rules [][]string
+	err := readCSV(strings.NewReader(file), func(ptype string, rule []string) error {
+		rules = append(rules, append([]string(nil), rule...))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected readCSV() to be successful; got %v", err)
+	}
+	want := [][]string{{" alice", "data1 ", "read"}, {"bob", "data2", "write"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("Expected rules %q; got %q", want, rules)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+
+	"github.com/casbin/casbin/v2/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PolicyDiff is the difference between the stored rules and the policy of a
+// model, see DiffPolicy. Rules are given as their ptype followed by their
+// values. A rule held more than once is listed once for each copy.
+type PolicyDiff struct {
+	// OnlyStored are the stored rules the model does not hold, which
+	// SavePolicy would remove.
+	OnlyStored [][]string
+	// OnlyModel are the rules of the model that are not stored, which
+	// SavePolicy would add.
+	OnlyModel [][]string
+	// Both are the rules held by both, which SavePolicy would keep.
+	Both [][]string
+}
+
+// DiffPolicy compares the stored rules with the policy of model without
+// changing anything, so that a deployment can preview what SavePolicy would
+// change, and ask for approval first. Like SavePolicy, it compares only the
+// rules matching the filter of the last LoadFilteredPolicy, if any.
+func (a *Adapter) DiffPolicy(model model.Model) (*PolicyDiff, error) {
+	return a.DiffPolicyCtx(context.Background(), model)
+}
+
+// DiffPolicyCtx is like DiffPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) DiffPolicyCtx(ctx context.Context, model model.Model) (diff *PolicyDiff, err error) {
+	ctx, end := a.begin(ctx, "DiffPolicy")
+	defer func() { err = end(err) }()
+
+	selector, filtered := a.loadedFilter()
+	if !filtered {
+		selector = a.scope(bson.M{})
+	}
+
+	var lines []CasbinRule
+	for _, ptype := range policyTypes(model) {
+		for _, rule := range findAssertion(model, ptype).Policy {
+			lines = append(lines, a.ruleLine(ptype, rule))
+		}
+	}
+	return a.diffLines(ctx, selector, lines)
+}
+
+// diffLines compares the rules matching the selector with lines.
+func (a *Adapter) diffLines(ctx context.Context, selector interface{}, lines []CasbinRule) (*PolicyDiff, error) {
+	stored := map[string]int{}
+	var order []CasbinRule
+	_, err := a.forEachLine(ctx, a.collection, selector, func(line CasbinRule) error {
+		if stored[line.key()] == 0 {
+			order = append(order, line)
+		}
+		stored[line.key()]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &PolicyDiff{OnlyStored: [][]string{}, OnlyModel: [][]string{}, Both: [][]string{}}
+	for _, line := range lines {
+		rule := append([]string{line.PType}, line.toStringPolicy()...)
+		if stored[line.key()] > 0 {
+			stored[line.key()]--
+			diff.Both = append(diff.Both, rule)
+			continue
+		}
+		diff.OnlyModel = append(diff.OnlyModel, rule)
+	}
+	for _, line := range order {
+		for ; stored[line.key()] > 0; stored[line.key()]-- {
+			diff.OnlyStored = append(diff.OnlyStored, append([]string{line.PType}, line.toStringPolicy()...))
+		}
+	}
+	return diff, nil
+}
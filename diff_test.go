@@ -0,0 +1,66 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAdapterDiffPolicy(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_diff")
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	if _, err := e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatalf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	e.EnableAutoSave(false)
+	if _, err := e.AddPolicy("carol", "data1", "read"); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if _, err := e.AddPolicy("alice", "data1", "read"); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if _, err := e.RemovePolicy("bob", "data2", "write"); err != nil {
+		t.Fatalf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+
+	diff, err := a.DiffPolicy(e.GetModel())
+	if err != nil {
+		t.Fatalf("Expected DiffPolicy() to be successful; got %v", err)
+	}
+	if want := [][]string{{"p", "bob", "data2", "write"}}; !reflect.DeepEqual(diff.OnlyStored, want) {
+		t.Errorf("Expected rules only stored to be %v; got %v", want, diff.OnlyStored)
+	}
+	if want := [][]string{{"p", "carol", "data1", "read"}, {"p", "alice", "data1", "read"}}; !reflect.DeepEqual(diff.OnlyModel, want) {
+		t.Errorf("Expected rules only in the model to be %v; got %v", want, diff.OnlyModel)
+	}
+	if len(diff.Both) != 3 {
+		t.Errorf("Expected 3 rules in both; got %v", diff.Both)
+	}
+
+	// Nothing is written.
+	if n, _ := a.collection.CountDocuments(context.Background(), bson.M{"v0": "carol"}); n != 0 {
+		t.Errorf("Expected DiffPolicy() not to store rules; got %d", n)
+	}
+}
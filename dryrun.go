@@ -0,0 +1,52 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DryRun describes the changes a destructive operation would have made, see
+// WithDryRun. Rules are given as their ptype followed by their values.
+type DryRun struct {
+	// Operation is "SavePolicy", "RemoveFilteredPolicy" or "dropTable".
+	Operation string
+	// Added are the rules that would have been stored.
+	Added [][]string
+	// Removed are the stored rules that would have been removed.
+	Removed [][]string
+}
+
+// dryRun reports the difference between the rules matching the selector and
+// lines to the dry-run callback, instead of replacing the ones with the
+// others.
+func (a *Adapter) dryRun(ctx context.Context, op string, selector interface{}, lines []CasbinRule) error {
+	diff, err := a.diffLines(ctx, selector, lines)
+	if err != nil {
+		return err
+	}
+
+	run := &DryRun{Operation: op, Added: diff.OnlyModel, Removed: diff.OnlyStored}
+	a.debug("dry run", "operation", op, "added", len(run.Added), "removed", len(run.Removed))
+	a.dryRunReport(run)
+	return nil
+}
+
+// dryRunDrop reports every document of the collection as removed.
+func (a *Adapter) dryRunDrop(ctx context.Context) error {
+	return a.dryRun(ctx, "dropTable", bson.M{}, nil)
+}
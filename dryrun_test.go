@@ -0,0 +1,67 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/casbin/casbin/v2/util"
+)
+
+func TestDryRun(t *testing.T) {
+	initPolicy(t)
+
+	var runs []*DryRun
+	a, err := NewAdapterWithError(getDbURL(), WithDryRun(func(run *DryRun) { runs = append(runs, run) }))
+	if err != nil {
+		t.Fatalf("Expected NewAdapterWithError() to be successful; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.EnableAutoSave(false)
+	e.RemovePolicy("alice", "data1", "read")
+	e.AddPolicy("carol", "data3", "read")
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	if err := a.RemoveFilteredPolicy("p", "p", 1, "data2"); err != nil {
+		t.Fatalf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+	if err := a.dropTable(context.Background()); err != nil {
+		t.Fatalf("Expected dropTable() to be successful; got %v", err)
+	}
+
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 dry runs; got %d", len(runs))
+	}
+	if r := runs[0]; r.Operation != "SavePolicy" ||
+		!util.Array2DEquals(r.Added, [][]string{{"p", "carol", "data3", "read"}}) ||
+		!util.Array2DEquals(r.Removed, [][]string{{"p", "alice", "data1", "read"}}) {
+		t.Errorf("Unexpected dry run of SavePolicy(): %+v", r)
+	}
+	if r := runs[1]; r.Operation != "RemoveFilteredPolicy" || len(r.Added) != 0 || len(r.Removed) != 3 {
+		t.Errorf("Unexpected dry run of RemoveFilteredPolicy(): %+v", r)
+	}
+	if r := runs[2]; r.Operation != "dropTable" || len(r.Removed) != 5 {
+		t.Errorf("Unexpected dry run of dropTable(): %+v", r)
+	}
+
+	// Nothing was changed.
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// An Encryptor encrypts rule values before they are stored and decrypts them
+// when they are read, see WithEncryption. Encryption must be deterministic,
+// the same value always giving the same ciphertext, so that rules are still
+// found by their values. An Encryptor must be safe for concurrent use.
+//
+// MongoDB client-side field level encryption can be used by wrapping the
+// explicit deterministic encryption of a mongo.ClientEncryption and encoding
+// the ciphertext as a string.
+type Encryptor interface {
+	// Encrypt returns the ciphertext of the value.
+	Encrypt(value string) string
+	// Decrypt returns the value of a ciphertext returned by Encrypt.
+	Decrypt(ciphertext string) (string, error)
+}
+
+// aesEncryptor encrypts deterministically with AES-GCM, using the HMAC of
+// the value as the nonce. This is the synthetic IV construction of AES-SIV:
+// equal values give equal ciphertexts, and nothing else is revealed.
+type aesEncryptor struct {
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// NewAESEncryptor returns an Encryptor using AES-256-GCM with synthetic
+// nonces. The key must be 64 bytes long, the first half used for encryption
+// and the second half for deriving nonces.
+func NewAESEncryptor(key []byte) (Encryptor, error) {
+	if len(key) != 64 {
+		return nil, errors.New("encryption key must be 64 bytes long")
+	}
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesEncryptor{aead: aead, mac: append([]byte(nil), key[32:]...)}, nil
+}
+
+// nonce derives the nonce of the value.
+func (e *aesEncryptor) nonce(value []byte) []byte {
+	h := hmac.New(sha256.New, e.mac)
+	h.Write(value)
+	return h.Sum(nil)[:e.aead.NonceSize()]
+}
+
+// Encrypt implements Encryptor.
+func (e *aesEncryptor) Encrypt(value string) string {
+	nonce := e.nonce([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(e.aead.Seal(nonce, nonce, []byte(value), nil))
+}
+
+// Decrypt implements Encryptor.
+func (e *aesEncryptor) Decrypt(ciphertext string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < e.aead.NonceSize() {
+		return "", errors.New("malformed ciphertext")
+	}
+	nonce, data := data[:e.aead.NonceSize()], data[e.aead.NonceSize():]
+	value, err := e.aead.Open(nil, nonce, data, nil)
+	if err != nil || !hmac.Equal(nonce, e.nonce(value)) {
+		return "", errors.New("message authentication failed")
+	}
+	return string(value), nil
+}
+
+// encryptValue returns the value as stored at position i of a rule. Empty
+// values are stored as they are, so that missing values can still be told.
+func (a *Adapter) encryptValue(i int, v string) string {
+	if a.encryptor == nil || v == "" || !a.encrypted[i] {
+		return v
+	}
+	return a.encryptor.Encrypt(v)
+}
+
+// encryptValues returns the values of a rule as stored.
+func (a *Adapter) encryptValues(values []string) []string {
+	if a.encryptor == nil {
+		return values
+	}
+	encrypted := make([]string, len(values))
+	for i, v := range values {
+		encrypted[i] = a.encryptValue(i, v)
+	}
+	return encrypted
+}
+
+// decryptValues decrypts the values of a stored rule in place.
+func (a *Adapter) decryptValues(values []string) error {
+	if a.encryptor == nil {
+		return nil
+	}
+	for i, v := range values {
+		if v == "" || !a.encrypted[i] {
+			continue
+		}
+		plain, err := a.encryptor.Decrypt(v)
+		if err != nil {
+			return &wrappedError{sentinel: ErrDecrypt, err: err}
+		}
+		values[i] = plain
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAESEncryptor(t *testing.T) {
+	if _, err := NewAESEncryptor(make([]byte, 32)); err == nil {
+		t.Errorf("Expected NewAESEncryptor() to fail for a short key")
+	}
+
+	enc, err := NewAESEncryptor(bytes.Repeat([]byte{1}, 64))
+	if err != nil {
+		t.Fatalf("Expected NewAESEncryptor() to be successful; got %v", err)
+	}
+	ciphertext := enc.Encrypt("alice")
+	if ciphertext == "alice" || enc.Encrypt("alice") != ciphertext {
+		t.Errorf("Expected Encrypt() to be deterministic; got %q", ciphertext)
+	}
+	if value, err := enc.Decrypt(ciphertext); err != nil || value != "alice" {
+		t.Errorf("Expected Decrypt() to return %q; got %q, %v", "alice", value, err)
+	}
+
+	other, _ := NewAESEncryptor(bytes.Repeat([]byte{2}, 64))
+	if _, err := other.Decrypt(ciphertext); err == nil {
+		t.Errorf("Expected Decrypt() to fail with another key")
+	}
+}
+
+func TestAdapterWithEncryption(t *testing.T) {
+	enc, _ := NewAESEncryptor(bytes.Repeat([]byte{1}, 64))
+	a := newTestAdapter(t, "casbin_rule_encryption", WithEncryption(enc, "v0", "v1"))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	// The values are stored encrypted.
+	n, err := a.collection.CountDocuments(context.Background(), bson.M{"v0": "alice"})
+	if err != nil || n != 0 {
+		t.Errorf("Expected no plain values to be stored; got %d, %v", n, err)
+	}
+	n, err = a.collection.CountDocuments(context.Background(), bson.M{"v2": "read"})
+	if err != nil || n != 2 {
+		t.Errorf("Expected unencrypted fields to be stored plain; got %d, %v", n, err)
+	}
+
+	e = newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"); err != nil {
+		t.Errorf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+	if err := a.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Errorf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	if err := a.LoadFilteredPolicy(e.GetModel(), &Filter{V1: []string{"data1"}}); err != nil {
+		t.Errorf("Expected LoadFilteredPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+
+	// Values encrypted with another key cannot be read.
+	other, _ := NewAESEncryptor(bytes.Repeat([]byte{2}, 64))
+	b := newTestAdapter(t, "casbin_rule_encryption", WithEncryption(other, "v0", "v1"))
+	defer b.Close()
+	if err := b.LoadPolicy(e.GetModel()); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Expected LoadPolicy() to fail with ErrDecrypt; got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Errors returned by the adapter, possibly wrapping the error of the driver.
+// Test for them with errors.Is.
+var (
+	// ErrNotConnected is returned when the server cannot be reached, or the
+	// adapter has been closed.
+	ErrNotConnected = errors.New("not connected to the server")
+	// ErrCollectionMissing is returned when an operation requires the policy
+	// collection to exist, and it does not.
+	ErrCollectionMissing = errors.New("policy collection does not exist")
+	// ErrRuleNotFound is returned when a rule to update is not stored.
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrDuplicateRule is returned when a rule is added that is stored
+	// already, and a unique index forbids storing it twice.
+	ErrDuplicateRule = errors.New("rule already exists")
+	// ErrChangeStreamsUnsupported is returned by NewWatcher when the server
+	// does not support change streams, such as a standalone server or some
+	// versions of Amazon DocumentDB.
+	ErrChangeStreamsUnsupported = errors.New("change streams are not supported by the server")
+	// ErrSaveLocked is returned when the save lock is held by another
+	// adapter, see AcquireSaveLock and WithSaveLock.
+	ErrSaveLocked = errors.New("policy is locked for saving by another process")
+	// ErrInvalidRule is returned when a rule to store has more values than
+	// the schema holds, or does not match the model set with WithValidation.
+	ErrInvalidRule = errors.New("invalid rule")
+	// ErrDecrypt is returned when a stored value cannot be decrypted, for
+	// example because it was encrypted with another key, see WithEncryption.
+	ErrDecrypt = errors.New("cannot decrypt rule value")
+	// ErrSaveMismatch is returned by SavePolicy when the rules read back
+	// after saving differ from the saved ones, see WithVerifyAfterSave.
+	ErrSaveMismatch = errors.New("saved rules do not match the policy")
+	// ErrThrottled is returned when a change exceeds the rate limit, see
+	// WithRateLimit.
+	ErrThrottled = errors.New("rate limit exceeded")
+	// ErrCircuitOpen is returned without contacting the server after
+	// repeated failures to reach it, see WithCircuitBreaker.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+)
+
+// wrappedError attaches one of the errors above to an error of the driver.
+type wrappedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *wrappedError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+func (e *wrappedError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+// classify wraps an error of the driver in the matching error of the adapter,
+// if any.
+func classify(err error) error {
+	var sentinel error
+	var serverErr mongo.ServerError
+	var selectionErr topology.ServerSelectionError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotConnected), errors.Is(err, ErrCollectionMissing),
+		errors.Is(err, ErrRuleNotFound), errors.Is(err, ErrDuplicateRule),
+		errors.Is(err, ErrChangeStreamsUnsupported), errors.Is(err, ErrSaveLocked),
+		errors.Is(err, ErrInvalidRule), errors.Is(err, ErrDecrypt),
+		errors.Is(err, ErrSaveMismatch), errors.Is(err, ErrThrottled),
+		errors.Is(err, ErrCircuitOpen):
+		return err
+	case errors.Is(err, mongo.ErrClientDisconnected), errors.As(err, &selectionErr):
+		sentinel = ErrNotConnected
+	case mongo.IsDuplicateKeyError(err):
+		sentinel = ErrDuplicateRule
+	case errors.As(err, &serverErr) && serverErr.HasErrorCode(26): // NamespaceNotFound
+		sentinel = ErrCollectionMissing
+	default:
+		return err
+	}
+	return &wrappedError{sentinel: sentinel, err: err}
+}
+
+// changeStreamsUnsupportedCodes are the server error codes reported when a
+// change stream is opened on a server that does not support them.
+var changeStreamsUnsupportedCodes = []int{
+	115,   // CommandNotSupported
+	40324, // Unrecognized pipeline stage name
+	40573, // The $changeStream stage is only supported on replica sets
+}
+
+// changeStreamError wraps the error of opening a change stream in
+// ErrChangeStreamsUnsupported if the server does not support them.
+func changeStreamError(err error) error {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+	for _, code := range changeStreamsUnsupportedCodes {
+		if serverErr.HasErrorCode(code) {
+			return &wrappedError{sentinel: ErrChangeStreamsUnsupported, err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestClassify(t *testing.T) {
+	err := classify(mongo.CommandError{Code: 26, Name: "NamespaceNotFound", Message: "ns not found"})
+	if !errors.Is(err, ErrCollectionMissing) {
+		t.Errorf("Expected ErrCollectionMissing; got %v", err)
+	}
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != 26 {
+		t.Errorf("Expected the driver error to stay accessible; got %v", err)
+	}
+
+	if err := classify(mongo.ErrClientDisconnected); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected; got %v", err)
+	}
+
+	plain := errors.New("boom")
+	if err := classify(plain); err != plain {
+		t.Errorf("Expected other errors to be returned as is; got %v", err)
+	}
+}
+
+func TestChangeStreamError(t *testing.T) {
+	err := changeStreamError(mongo.CommandError{Code: 40573, Message: "The $changeStream stage is only supported on replica sets"})
+	if !errors.Is(err, ErrChangeStreamsUnsupported) {
+		t.Errorf("Expected ErrChangeStreamsUnsupported; got %v", err)
+	}
+	if err := classify(err); !errors.Is(err, ErrChangeStreamsUnsupported) {
+		t.Errorf("Expected classify() to keep ErrChangeStreamsUnsupported; got %v", err)
+	}
+
+	denied := mongo.CommandError{Code: 13, Name: "Unauthorized"}
+	if err := changeStreamError(denied); errors.Is(err, ErrChangeStreamsUnsupported) {
+		t.Errorf("Expected other errors to be returned as is; got %v", err)
+	}
+}
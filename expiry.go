@@ -0,0 +1,49 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// AddPolicyWithTTL adds a policy rule to the storage like AddPolicy, which
+// expires after ttl, for example a temporary access grant. An expired rule
+// is no longer loaded, and is removed by the server soon after. SavePolicy
+// keeps the expiry of the rules it stores again. It requires WithExpiry.
+func (a *Adapter) AddPolicyWithTTL(sec string, ptype string, rule []string, ttl time.Duration) error {
+	return a.AddPolicyWithTTLCtx(context.Background(), sec, ptype, rule, ttl)
+}
+
+// AddPolicyWithTTLCtx is like AddPolicyWithTTL but honors the deadline and cancellation of ctx.
+func (a *Adapter) AddPolicyWithTTLCtx(ctx context.Context, sec string, ptype string, rule []string, ttl time.Duration) (err error) {
+	ctx, end := a.begin(ctx, "AddPolicyWithTTL")
+	defer func() { err = end(err) }()
+
+	if !a.expiry {
+		return errors.New("expiry is not enabled")
+	}
+	if ttl <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if err := a.validateRule(ptype, rule); err != nil {
+		return err
+	}
+
+	line := a.ruleLine(ptype, rule)
+	line.ExpiresAt = time.Now().Add(ttl)
+	return a.addLine(ctx, line)
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAddPolicyWithTTL(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_expiry", WithExpiry())
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithTTL("p", "p", []string{"bob", "data2", "write"}, time.Hour); err != nil {
+		t.Fatalf("Expected AddPolicyWithTTL() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithTTL("p", "p", []string{"carol", "data3", "read"}, 500*time.Millisecond); err != nil {
+		t.Fatalf("Expected AddPolicyWithTTL() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithTTL("p", "p", []string{"dave", "data4", "read"}, 0); err == nil {
+		t.Error("Expected AddPolicyWithTTL() to reject a ttl of 0")
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"carol", "data3", "read"}})
+
+	// Expired rules are skipped before the server removes them.
+	time.Sleep(time.Second)
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	// Saving keeps the expiry of a temporary rule.
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	n, err := a.collection.CountDocuments(context.Background(), bson.M{"v0": "bob", "expires_at": bson.M{"$exists": true}})
+	if err != nil || n != 1 {
+		t.Errorf("Expected the saved rule to keep its expiry; got %d, %v", n, err)
+	}
+}
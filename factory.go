@@ -0,0 +1,151 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AdapterFactory creates named adapters that share one client, and with it
+// one connection pool, such as for a service running an RBAC, an ABAC and a
+// tenant-scoping enforcer, each with a policy collection of its own. The
+// factory owns the adapters it creates: closing it closes them, and
+// disconnects the client if the factory dialed it.
+type AdapterFactory struct {
+	client       *mongo.Client
+	ownsClient   bool
+	databaseName string
+	opts         []Option
+
+	mu       sync.Mutex
+	adapters map[string]*Adapter
+	closed   bool
+}
+
+// NewAdapterFactory dials the server of url once for all adapters of the
+// factory. The options apply to every adapter the factory creates, before
+// the options given to Adapter; connection options such as WithPoolSize,
+// WithTLSConfig and WithCredential configure the shared client.
+func NewAdapterFactory(url string, opts ...Option) (*AdapterFactory, error) {
+	a, err := newAdapter(opts)
+	if err != nil {
+		return nil, err
+	}
+	a.url = url
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	client, err := a.dial(ctx, a.credential)
+	if err != nil {
+		return nil, classify(err)
+	}
+	return &AdapterFactory{
+		client:       client,
+		ownsClient:   true,
+		databaseName: a.databaseName,
+		opts:         opts,
+		adapters:     map[string]*Adapter{},
+	}, nil
+}
+
+// NewAdapterFactoryWithClient is like NewAdapterFactory but reuses an
+// existing client, see NewAdapterWithClient. Closing the factory leaves the
+// client connected.
+func NewAdapterFactoryWithClient(client *mongo.Client, databaseName string, opts ...Option) (*AdapterFactory, error) {
+	if client == nil {
+		return nil, errors.New("client must not be nil")
+	}
+	return &AdapterFactory{
+		client:       client,
+		databaseName: databaseName,
+		opts:         opts,
+		adapters:     map[string]*Adapter{},
+	}, nil
+}
+
+// Adapter returns the adapter named name, creating it on first use. A new
+// adapter stores its rules in the collection of the same name, unless the
+// options select another one with WithCollection. Later calls return the
+// same adapter; passing options for an adapter that exists already is an
+// error, as they could not be applied.
+func (f *AdapterFactory) Adapter(name string, opts ...Option) (*Adapter, error) {
+	if name == "" {
+		return nil, errors.New("adapter name must not be empty")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, errors.New("adapter factory is closed")
+	}
+	if a, ok := f.adapters[name]; ok {
+		if len(opts) > 0 {
+			return nil, errors.New("adapter " + strconv.Quote(name) + " exists already, its options cannot be changed")
+		}
+		return a, nil
+	}
+
+	all := make([]Option, 0, len(f.opts)+len(opts)+1)
+	all = append(all, f.opts...)
+	all = append(all, WithCollection(name))
+	all = append(all, opts...)
+	a, err := NewAdapterWithClient(f.client, f.databaseName, all...)
+	if err != nil {
+		return nil, err
+	}
+	f.adapters[name] = a
+	return a, nil
+}
+
+// Names returns the names of the adapters created so far.
+func (f *AdapterFactory) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0, len(f.adapters))
+	for name := range f.adapters {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Close closes every adapter of the factory, and disconnects the client if
+// the factory dialed it. Adapter fails afterwards.
+func (f *AdapterFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	// The adapters do not own the client, so closing them only stops their
+	// background work.
+	for _, a := range f.adapters {
+		_ = a.Close()
+	}
+	if f.ownsClient {
+		return f.client.Disconnect(context.Background())
+	}
+	return nil
+}
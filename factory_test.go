@@ -0,0 +1,69 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAdapterFactory(t *testing.T) {
+	f, err := NewAdapterFactory(getDbURL(), WithFieldIndexes("ptype", "v0"))
+	if err != nil {
+		t.Fatalf("Expected NewAdapterFactory() to be successful; got %v", err)
+	}
+
+	rbac, err := f.Adapter("casbin_rule_factory_rbac")
+	if err != nil {
+		t.Fatalf("Expected Adapter() to be successful; got %v", err)
+	}
+	defer rbac.dropTable(context.Background())
+	abac, err := f.Adapter("casbin_rule_factory_abac")
+	if err != nil {
+		t.Fatalf("Expected Adapter() to be successful; got %v", err)
+	}
+	defer abac.dropTable(context.Background())
+
+	if again, _ := f.Adapter("casbin_rule_factory_rbac"); again != rbac {
+		t.Errorf("Expected Adapter() to return the adapter created before")
+	}
+	if _, err := f.Adapter("casbin_rule_factory_rbac", WithFieldIndexes("v1")); err == nil {
+		t.Errorf("Expected Adapter() to fail for options of an existing adapter")
+	}
+	if rbac.client != abac.client {
+		t.Errorf("Expected the adapters to share the client")
+	}
+	if len(f.Names()) != 2 {
+		t.Errorf("Expected 2 adapters; got %v", f.Names())
+	}
+
+	if err := rbac.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	e := newEnforcer(t, "examples/rbac_model.conf", abac)
+	testGetPolicy(t, e, [][]string{})
+	e = newEnforcer(t, "examples/rbac_model.conf", rbac)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+
+	// Dropping the collections needs the client, so it happens before Close.
+	_ = rbac.dropTable(context.Background())
+	_ = abac.dropTable(context.Background())
+	if err := f.Close(); err != nil {
+		t.Fatalf("Expected Close() to be successful; got %v", err)
+	}
+	if _, err := f.Adapter("casbin_rule_factory_tenants"); err == nil {
+		t.Errorf("Expected Adapter() to fail after Close()")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Filter defines the filtering rules for LoadFilteredPolicy. Each field lists
+// the values that are accepted for that column; a rule matches when every
+// non-empty field contains its value. Empty fields are ignored.
+type Filter struct {
+	PType []string
+	V0    []string
+	V1    []string
+	V2    []string
+	V3    []string
+	V4    []string
+	V5    []string
+
+	// Raw is an additional MongoDB selector, such as a bson.M or bson.D,
+	// for matches the fields above cannot express: $regex, $exists, ranges
+	// and so on. A rule must match both Raw and the fields. Raw is matched
+	// against the stored values, which are ciphertexts for encrypted fields,
+	// see WithEncryption.
+	Raw interface{}
+}
+
+// selector converts the filter into a MongoDB selector for the schema of the
+// adapter, normalizing the values and encrypting the values of encrypted
+// fields.
+func (f *Filter) selector(a *Adapter) bson.M {
+	fields := []struct {
+		key    string
+		index  int
+		values []string
+	}{
+		{"ptype", -1, f.PType},
+		{"v0", 0, f.V0},
+		{"v1", 1, f.V1},
+		{"v2", 2, f.V2},
+		{"v3", 3, f.V3},
+		{"v4", 4, f.V4},
+		{"v5", 5, f.V5},
+	}
+
+	selector := bson.M{}
+	for _, field := range fields {
+		values := make([]string, len(field.values))
+		for i, v := range field.values {
+			values[i] = a.normalize(field.index, v)
+			if field.index >= 0 {
+				values[i] = a.encryptValue(field.index, values[i])
+			}
+		}
+
+		switch len(values) {
+		case 0:
+			continue
+		case 1:
+			selector[a.schema.field(field.key)] = values[0]
+		default:
+			selector[a.schema.field(field.key)] = bson.M{"$in": values}
+		}
+	}
+
+	if f.Raw != nil {
+		selector = bson.M{"$and": bson.A{selector, f.Raw}}
+	}
+	return selector
+}
@@ -0,0 +1,14 @@
+module github.com/casbin/mongodb-adapter/v2
+
+go 1.21
+
+require (
+	github.com/casbin/casbin/v2 v2.100.0
+	github.com/testcontainers/testcontainers-go v0.33.0
+	github.com/testcontainers/testcontainers-go/modules/mongodb v0.33.0
+	github.com/tryvium-travels/memongo v0.10.0
+	go.mongodb.org/mongo-driver v1.17.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
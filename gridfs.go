@@ -0,0 +1,271 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errNotImplemented is the error Casbin expects from adapters that do not
+// support saving single rules.
+var errNotImplemented = errors.New("not implemented")
+
+// GridFSAdapter stores the whole policy as a single compressed policy file in
+// GridFS, instead of a document per rule. Loading a policy of millions of
+// rules is much faster this way, but a rule can no longer be added or
+// removed by itself: every change is saved with SavePolicy, so the enforcer
+// must not save changes automatically (EnableAutoSave(false)).
+//
+// A head document records the current file, so readers see either the old
+// or the new policy while a save is in progress. The file format is that of
+// ExportPolicyCSV, compressed with gzip.
+type GridFSAdapter struct {
+	adapter    *Adapter
+	bucketName string
+	head       *mongo.Collection
+}
+
+var _ persist.Adapter = (*GridFSAdapter)(nil)
+
+// gridFSHead is the head document, which points to the current policy file
+// of a tenant.
+type gridFSHead struct {
+	Tenant  string             `bson:"_id"`
+	File    primitive.ObjectID `bson:"file"`
+	Version int64              `bson:"version"`
+	Time    time.Time          `bson:"time"`
+}
+
+// NewGridFSAdapter is the constructor for GridFSAdapter. It stores the policy
+// in the GridFS bucket of the given name, in the database of a, for a's
+// tenant, if any. The head documents are kept in the collection named after
+// the bucket with a ".head" suffix.
+func NewGridFSAdapter(a *Adapter, bucketName string) (*GridFSAdapter, error) {
+	if bucketName == "" {
+		return nil, errors.New("bucket name must not be empty")
+	}
+
+	db := a.collection.Database()
+	return &GridFSAdapter{
+		adapter:    a,
+		bucketName: bucketName,
+		head:       db.Collection(bucketName+".head", a.collectionOptions()),
+	}, nil
+}
+
+// bucket opens the GridFS bucket, bounded by the deadline of ctx. The driver
+// takes deadlines rather than contexts for GridFS.
+func (g *GridFSAdapter) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	db := g.adapter.collection.Database()
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(g.bucketName))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := bucket.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		if err := bucket.SetWriteDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
+
+// LoadPolicy loads the policy from the current policy file. The policy is
+// empty if none has been saved yet.
+func (g *GridFSAdapter) LoadPolicy(model model.Model) error {
+	return g.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx is like LoadPolicy but honors the deadline and cancellation of ctx.
+func (g *GridFSAdapter) LoadPolicyCtx(ctx context.Context, model model.Model) (err error) {
+	a := g.adapter
+	ctx, end := a.begin(ctx, "GridFSLoadPolicy")
+	defer func() { err = end(err) }()
+
+	bucket, err := g.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A concurrent save may delete the file between reading the head and
+	// opening the file; the head then points to a newer one.
+	for attempt := 1; ; attempt++ {
+		var head gridFSHead
+		err := g.head.FindOne(ctx, bson.M{"_id": a.tenant}).Decode(&head)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		stream, err := bucket.OpenDownloadStream(head.File)
+		if err == gridfs.ErrFileNotFound && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		rules := 0
+		err = readGzip(stream, func(r io.Reader) error {
+			return readCSV(r, func(ptype string, rule []string) error {
+				rules++
+				loadPolicyLine(a.ruleLine(ptype, rule), model)
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		a.rulesLoaded("GridFSLoadPolicy", rules)
+		return nil
+	}
+}
+
+// readGzip calls fn with the decompressed contents of r.
+func readGzip(r io.Reader, fn func(r io.Reader) error) error {
+	zr, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	return fn(zr)
+}
+
+// SavePolicy writes the policy to a new policy file, makes it the current
+// one, and deletes the previous file.
+func (g *GridFSAdapter) SavePolicy(model model.Model) error {
+	return g.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx is like SavePolicy but honors the deadline and cancellation of ctx.
+func (g *GridFSAdapter) SavePolicyCtx(ctx context.Context, model model.Model) (err error) {
+	a := g.adapter
+	ctx, end := a.begin(ctx, "GridFSSavePolicy")
+	defer func() { err = end(err) }()
+
+	bucket, err := g.bucket(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The file is compressed while it is uploaded, so it is never held in
+	// memory as a whole.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writePolicyFile(pw, model))
+	}()
+
+	file, err := bucket.UploadFromStream(policyFileName(a.tenant), pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	var old gridFSHead
+	err = g.head.FindOneAndUpdate(ctx,
+		bson.M{"_id": a.tenant},
+		bson.M{
+			"$set": bson.M{"file": file, "time": time.Now()},
+			"$inc": bson.M{"version": 1},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&old)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		// This is the first file.
+		return nil
+	case err != nil:
+		// Best effort; the new file is unused.
+		_ = bucket.Delete(file)
+		return err
+	}
+
+	if err := bucket.Delete(old.File); err != nil && err != gridfs.ErrFileNotFound {
+		a.debug("keeping previous policy file", "bucket", g.bucketName, "file", old.File, "error", err)
+	}
+	return nil
+}
+
+// policyFileName returns the name of the policy files of a tenant.
+func policyFileName(tenant string) string {
+	if tenant == "" {
+		return "policy.csv.gz"
+	}
+	return tenant + "/policy.csv.gz"
+}
+
+// writePolicyFile writes the rules of the model to w as a compressed policy
+// file.
+func writePolicyFile(w io.Writer, model model.Model) error {
+	zw := gzip.NewWriter(w)
+	buf := bufio.NewWriter(zw)
+	for _, ptype := range policyTypes(model) {
+		for _, rule := range findAssertion(model, ptype).Policy {
+			if _, err := buf.WriteString(csvLine(ptype, rule)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Version returns the number of times the policy has been saved, or 0 if it
+// never has.
+func (g *GridFSAdapter) Version(ctx context.Context) (int64, error) {
+	var head gridFSHead
+	err := g.head.FindOne(ctx, bson.M{"_id": g.adapter.tenant}).Decode(&head)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return head.Version, err
+}
+
+// AddPolicy is not supported; the policy can only be saved as a whole.
+func (g *GridFSAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return errNotImplemented
+}
+
+// RemovePolicy is not supported; the policy can only be saved as a whole.
+func (g *GridFSAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return errNotImplemented
+}
+
+// RemoveFilteredPolicy is not supported; the policy can only be saved as a
+// whole.
+func (g *GridFSAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errNotImplemented
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGridFSAdapter(t *testing.T) {
+	a, err := NewAdapterWithError(getDbURL())
+	if err != nil {
+		t.Fatalf("Expected NewAdapterWithError() to be successful; got %v", err)
+	}
+	g, err := NewGridFSAdapter(a, "casbin_policy_test")
+	if err != nil {
+		t.Fatalf("Expected NewGridFSAdapter() to be successful; got %v", err)
+	}
+	defer func() {
+		db := a.collection.Database()
+		for _, suffix := range []string{".files", ".chunks", ".head"} {
+			db.Collection("casbin_policy_test" + suffix).Drop(context.Background())
+		}
+	}()
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := g.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	e = newEnforcer(t, "examples/rbac_model.conf", g)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	e.EnableAutoSave(false)
+	e.RemovePolicy("alice", "data1", "read")
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatalf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if v, err := g.Version(context.Background()); err != nil || v != 2 {
+		t.Errorf("Expected version 2; got %d, %v", v, err)
+	}
+	db := a.collection.Database()
+	if n, _ := db.Collection("casbin_policy_test.files").CountDocuments(context.Background(), bson.M{}); n != 1 {
+		t.Errorf("Expected the previous policy file to be deleted; got %d files", n)
+	}
+	if err := g.AddPolicy("p", "p", []string{"carol", "data1", "read"}); err == nil || err.Error() != "not implemented" {
+		t.Errorf("Expected AddPolicy() not to be implemented; got %v", err)
+	}
+}
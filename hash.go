@@ -0,0 +1,96 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ruleHash returns the hash of a rule with the values as stored, the SHA-256
+// of the JSON array of the policy type and the values, in hex.
+func ruleHash(ptype string, values []string) string {
+	data, _ := json.Marshal(append([]string{ptype}, values...))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hash returns the hash stored with the line, see WithRuleHash.
+func (a *Adapter) hash(line CasbinRule) string {
+	return ruleHash(line.PType, a.encryptValues(line.toStringPolicy()))
+}
+
+// hashSelector returns the selector matching the stored rule of the line by
+// its hash. Writes to a sharded collection must also match the shard key.
+func (a *Adapter) hashSelector(line CasbinRule) bson.D {
+	selector := bson.D{{Key: a.schema.Hash, Value: a.hash(line)}}
+	if line.Tenant != "" {
+		selector = append(selector, bson.E{Key: a.schema.Tenant, Value: line.Tenant})
+	}
+	if len(a.shardKey) > 0 {
+		fields := a.fields(line)
+		for _, k := range a.shardKey {
+			if k == "tenant" {
+				continue
+			}
+			field := a.schema.field(k)
+			for _, e := range fields {
+				if e.Key == field {
+					selector = append(selector, e)
+				}
+			}
+		}
+	}
+	return selector
+}
+
+// hashRules stores the hash with the rules stored without one, such as the
+// rules stored before WithRuleHash was given.
+func (a *Adapter) hashRules(ctx context.Context) error {
+	selector := bson.M{a.schema.PType: bson.M{"$exists": true}, a.schema.Hash: bson.M{"$exists": false}}
+	cursor, err := a.collection.Find(ctx, selector)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	for cursor.Next(ctx) {
+		line := a.decodeStored(cursor.Current)
+		update := bson.M{"$set": bson.M{a.schema.Hash: ruleHash(line.PType, line.toStringPolicy())}}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: cursor.Current.Lookup("_id")}}).
+			SetUpdate(update))
+
+		if len(models) == migrateBatchSize {
+			if err := a.bulkWrite(ctx, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(models) > 0 {
+		return a.bulkWrite(ctx, models)
+	}
+	return nil
+}
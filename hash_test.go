@@ -0,0 +1,57 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAdapterWithRuleHash(t *testing.T) {
+	// Rules stored before the hash was enabled get one.
+	a := newTestAdapter(t, "casbin_rule_hash")
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	a.Close()
+
+	a = newTestAdapter(t, "casbin_rule_hash", WithRuleHash())
+
+	n, err := a.collection.CountDocuments(context.Background(), bson.M{"hash": bson.M{"$exists": false}})
+	if err != nil || n != 0 {
+		t.Errorf("Expected every rule to have a hash; got %d without, %v", n, err)
+	}
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); !errors.Is(err, ErrDuplicateRule) {
+		t.Errorf("Expected AddPolicy() to fail with ErrDuplicateRule; got %v", err)
+	}
+	if err := a.RemovePolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Errorf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	if err := a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+		t.Errorf("Expected UpdatePolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	e = newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"alice", "data1", "read"}})
+}
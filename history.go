@@ -0,0 +1,262 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxVersionAttempts bounds the retries of recording a version when
+// concurrent writers claim the same version number.
+const maxVersionAttempts = 5
+
+// Version describes a version of the policy kept in the history, see
+// WithHistory.
+type Version struct {
+	Version   int64
+	Time      time.Time
+	Operation string
+	Rules     int
+}
+
+// versionDoc is the document stored in the history for each version. A rule
+// is stored as its ptype followed by its values.
+type versionDoc struct {
+	Tenant    string     `bson:"tenant"`
+	Version   int64      `bson:"version"`
+	Time      time.Time  `bson:"time"`
+	Operation string     `bson:"operation"`
+	Rules     [][]string `bson:"rules"`
+}
+
+// createHistoryIndexes creates the index that numbers the versions of each
+// tenant.
+func (a *Adapter) createHistoryIndexes(ctx context.Context) error {
+	_, err := a.history.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// withHistory runs fn like withTransaction, and then records the resulting
+// policy as a new version if the adapter keeps a history, and the change in
+// the audit log if it keeps one. Every write of the adapter goes through
+// withHistory, which retries it after transient errors if it runs in a
+// transaction, see WithRetry, or after throttling if it can run again, see
+// WithCosmosDB, and invalidates the cache, see WithCache, and calls the hooks,
+// see WithHooks.
+func (a *Adapter) withHistory(ctx context.Context, c change, fn func(ctx context.Context) error) (err error) {
+	if a.limiter != nil {
+		if err := a.limiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Even a failed write may have changed some rules.
+	defer a.InvalidateCache()
+
+	entry := c.entry(ctx)
+	if len(a.hooks) > 0 {
+		if err := a.beforeChange(ctx, &entry); err != nil {
+			return err
+		}
+		defer func() { a.afterChange(ctx, &entry, err) }()
+	}
+
+	if !a.transactions && c.rejectable {
+		// A throttled request was rejected as a whole, and running upserts
+		// again stores each rule at most once.
+		single := fn
+		fn = func(ctx context.Context) error {
+			return a.retryThrottled(ctx, single)
+		}
+	}
+	write := func(ctx context.Context) error {
+		if a.history == nil {
+			return a.withTransaction(ctx, fn)
+		}
+
+		return a.withTransaction(ctx, func(ctx context.Context) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return a.recordVersion(ctx, c.op)
+		})
+	}
+	if a.transactions {
+		// A failed transaction is rolled back, so it can run again.
+		err = a.retry(ctx, write)
+	} else {
+		// Part of the write may have been applied before the error, and
+		// running it again could store rules twice. The driver retries
+		// single writes safely by itself, and fn retries throttled ones.
+		err = write(ctx)
+	}
+	if err != nil || a.auditLog == nil {
+		return err
+	}
+	return a.recordAudit(ctx, entry)
+}
+
+// recordVersion appends a snapshot of the stored policy to the history.
+func (a *Adapter) recordVersion(ctx context.Context, op string) error {
+	cursor, err := a.collection.Find(ctx, a.scope(bson.M{}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	rules := [][]string{}
+	for cursor.Next(ctx) {
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, append([]string{line.PType}, line.toStringPolicy()...))
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		last, err := a.latestVersion(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = a.history.InsertOne(ctx, versionDoc{
+			Tenant:    a.tenant,
+			Version:   last + 1,
+			Time:      time.Now(),
+			Operation: op,
+			Rules:     rules,
+		})
+		if mongo.IsDuplicateKeyError(err) && attempt < maxVersionAttempts {
+			// Another writer recorded the same version first.
+			continue
+		}
+		return err
+	}
+}
+
+// latestVersion returns the number of the latest version in the history, or
+// 0 if there is none.
+func (a *Adapter) latestVersion(ctx context.Context) (int64, error) {
+	var doc versionDoc
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := a.history.FindOne(ctx, bson.M{"tenant": a.tenant}, opts).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	return doc.Version, err
+}
+
+// ListVersions returns the versions of the policy kept in the history,
+// oldest first. It requires WithHistory.
+func (a *Adapter) ListVersions() ([]Version, error) {
+	return a.ListVersionsCtx(context.Background())
+}
+
+// ListVersionsCtx is like ListVersions but honors the deadline and cancellation of ctx.
+func (a *Adapter) ListVersionsCtx(ctx context.Context) (versions []Version, err error) {
+	ctx, end := a.begin(ctx, "ListVersions")
+	defer func() { err = end(err) }()
+
+	if a.history == nil {
+		return nil, errors.New("history is not enabled")
+	}
+
+	// The number of rules is computed by the server, to leave the snapshots
+	// there.
+	cursor, err := a.history.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"tenant": a.tenant}}},
+		{{Key: "$sort", Value: bson.M{"version": 1}}},
+		{{Key: "$project", Value: bson.M{
+			"version":   1,
+			"time":      1,
+			"operation": 1,
+			"rules":     bson.M{"$size": "$rules"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions = []Version{}
+	for cursor.Next(ctx) {
+		var v struct {
+			Version   int64     `bson:"version"`
+			Time      time.Time `bson:"time"`
+			Operation string    `bson:"operation"`
+			Rules     int       `bson:"rules"`
+		}
+		if err := cursor.Decode(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, Version(v))
+	}
+
+	return versions, cursor.Err()
+}
+
+// RestoreVersion replaces the stored policy with the given version from the
+// history. The restored policy is recorded as a new version, so a restore can
+// be undone as well. Enforcers using the adapter must reload the policy.
+func (a *Adapter) RestoreVersion(version int64) error {
+	return a.RestoreVersionCtx(context.Background(), version)
+}
+
+// RestoreVersionCtx is like RestoreVersion but honors the deadline and cancellation of ctx.
+func (a *Adapter) RestoreVersionCtx(ctx context.Context, version int64) (err error) {
+	ctx, end := a.begin(ctx, "RestoreVersion")
+	defer func() { err = end(err) }()
+
+	if a.history == nil {
+		return errors.New("history is not enabled")
+	}
+	if err := a.checkUnscoped(ctx, "restore"); err != nil {
+		return err
+	}
+
+	var doc versionDoc
+	err = a.history.FindOne(ctx, bson.M{"tenant": a.tenant, "version": version}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return errors.New("version " + strconv.FormatInt(version, 10) + " does not exist")
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := make([]CasbinRule, 0, len(doc.Rules))
+	for _, rule := range doc.Rules {
+		if len(rule) == 0 {
+			continue
+		}
+		lines = append(lines, a.ruleLine(rule[0], rule[1:]))
+	}
+
+	return a.withHistory(ctx, change{op: "restore"}, func(ctx context.Context) error {
+		return a.replaceLines(ctx, a.scope(bson.M{}), false, lines)
+	})
+}
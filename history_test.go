@@ -0,0 +1,66 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_versioned", WithHistory(""))
+	defer a.history.Drop(context.Background())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.AddPolicy("alice", "data1", "read")
+	e.AddPolicy("bob", "data2", "write")
+	e.RemovePolicy("alice", "data1", "read")
+
+	versions, err := a.ListVersions()
+	if err != nil {
+		t.Fatalf("Expected ListVersions() to be successful; got %v", err)
+	}
+	if len(versions) != 3 {
+		t.Fatalf("Expected 3 versions; got %v", versions)
+	}
+	if v := versions[1]; v.Version != 2 || v.Operation != "add" || v.Rules != 2 {
+		t.Errorf("Unexpected version: %+v", v)
+	}
+
+	// Roll back the removal.
+	if err := a.RestoreVersion(2); err != nil {
+		t.Errorf("Expected RestoreVersion() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	if versions, _ := a.ListVersions(); len(versions) != 4 || versions[3].Operation != "restore" {
+		t.Errorf("Expected the restore to be recorded; got %v", versions)
+	}
+	if err := a.RestoreVersion(42); err == nil {
+		t.Errorf("Expected RestoreVersion() to fail for a missing version")
+	}
+
+	// Once the collection holds rules of a tenant, the unscoped adapter
+	// cannot restore the rules of all tenants.
+	if err := a.WithTenant("acme").AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.RestoreVersion(1); err == nil {
+		t.Errorf("Expected RestoreVersion() of an unscoped adapter to fail")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import "context"
+
+// Hooks are called around every change of the stored policy, such as an
+// AddPolicy, RemoveFilteredPolicy or SavePolicy, for example to validate
+// rules, bust caches or audit changes in another system, see WithHooks. The
+// change is described as in the audit log; switch on its Operation to handle
+// additions, removals, updates and saves differently. Hooks are called
+// synchronously and must be safe for concurrent use.
+type Hooks interface {
+	// BeforeChange is called before the change is written. If it returns an
+	// error, the change is not written and the operation fails with that
+	// error.
+	BeforeChange(ctx context.Context, change *AuditEntry) error
+	// AfterChange is called once the change was written, or failed with err.
+	// It is not called for changes rejected by BeforeChange.
+	AfterChange(ctx context.Context, change *AuditEntry, err error)
+}
+
+// beforeChange calls the BeforeChange hooks in order, stopping at the first
+// error.
+func (a *Adapter) beforeChange(ctx context.Context, entry *AuditEntry) error {
+	for _, h := range a.hooks {
+		if err := h.BeforeChange(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterChange calls the AfterChange hooks in reverse order, so that hooks
+// nest like middleware.
+func (a *Adapter) afterChange(ctx context.Context, entry *AuditEntry, err error) {
+	for i := len(a.hooks) - 1; i >= 0; i-- {
+		a.hooks[i].AfterChange(ctx, entry, err)
+	}
+}
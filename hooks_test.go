@@ -0,0 +1,71 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/casbin/casbin/v2/util"
+)
+
+// recordingHooks records the changes it sees, and rejects rules of "mallory".
+type recordingHooks struct {
+	before []string
+	after  []string
+}
+
+func (h *recordingHooks) BeforeChange(ctx context.Context, change *AuditEntry) error {
+	h.before = append(h.before, change.Operation)
+	for _, rule := range change.Rules {
+		if rule[0] == "mallory" {
+			return errors.New("mallory is not welcome")
+		}
+	}
+	return nil
+}
+
+func (h *recordingHooks) AfterChange(ctx context.Context, change *AuditEntry, err error) {
+	h.after = append(h.after, change.Operation)
+}
+
+func TestHooks(t *testing.T) {
+	h := &recordingHooks{}
+	a := newTestAdapter(t, "casbin_rule_hooks", WithHooks(h))
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"mallory", "data1", "read"}); err == nil {
+		t.Error("Expected AddPolicy() to be rejected by the hook")
+	}
+	if err := a.RemoveFilteredPolicy("p", "p", 1, "data2"); err != nil {
+		t.Errorf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	if err := e.SavePolicy(); err != nil {
+		t.Errorf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	if got, want := h.before, []string{"add", "add", "remove", "save"}; !util.ArrayEquals(got, want) {
+		t.Errorf("Expected BeforeChange() for %v; got %v", want, got)
+	}
+	if got, want := h.after, []string{"add", "remove", "save"}; !util.ArrayEquals(got, want) {
+		t.Errorf("Expected AfterChange() for %v; got %v", want, got)
+	}
+}
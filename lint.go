@@ -0,0 +1,149 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LintKind is the kind of issue a LintFinding reports.
+type LintKind string
+
+const (
+	// LintUnknownPType is a rule of a policy type the model does not define.
+	LintUnknownPType LintKind = "unknown-ptype"
+	// LintArity is a rule with more or fewer values than the model defines
+	// for its policy type.
+	LintArity LintKind = "arity"
+	// LintOrphanRole is a role assigned by a "g" rule that neither has
+	// "p" rules of its own nor inherits from a role that has, so assigning
+	// it grants nothing.
+	LintOrphanRole LintKind = "orphan-role"
+	// LintDuplicate is a rule stored more than once.
+	LintDuplicate LintKind = "duplicate"
+)
+
+// A LintFinding is an issue of a stored rule, see LintPolicies.
+type LintFinding struct {
+	Kind  LintKind
+	PType string
+	Rule  []string
+	// Message describes the issue.
+	Message string
+}
+
+// LintPolicies checks the stored rules against m for common mistakes and
+// returns what it finds, such as for a CI gate that fails on any finding:
+// rules of policy types m does not define, rules with the wrong number of
+// values, roles assigned by "g" rules that grant nothing, and rules stored
+// more than once. Role assignments are followed regardless of their domain.
+// The rules are read from the server; the policy m holds is ignored.
+func (a *Adapter) LintPolicies(m model.Model) ([]LintFinding, error) {
+	return a.LintPoliciesCtx(context.Background(), m)
+}
+
+// LintPoliciesCtx is like LintPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) LintPoliciesCtx(ctx context.Context, m model.Model) (findings []LintFinding, err error) {
+	ctx, end := a.begin(ctx, "LintPolicies")
+	defer func() { err = end(err) }()
+
+	if m == nil {
+		return nil, errors.New("model must not be nil")
+	}
+
+	findings = []LintFinding{}
+	seen := map[string]int{}
+	granted := map[string]bool{}
+	parents := map[string][]string{}
+	var assignments []CasbinRule
+	_, err = a.forEachLine(ctx, a.loads, a.scope(bson.M{}), func(line CasbinRule) error {
+		rule := line.toStringPolicy()
+		finding := func(kind LintKind, message string) {
+			findings = append(findings, LintFinding{Kind: kind, PType: line.PType, Rule: rule, Message: message})
+		}
+
+		seen[line.key()]++
+		if seen[line.key()] == 2 {
+			finding(LintDuplicate, line.PType+" rule ["+strings.Join(rule, ", ")+"] is stored more than once")
+		}
+
+		ast, ok := m["p"][line.PType]
+		if !ok {
+			ast, ok = m["g"][line.PType]
+		}
+		if !ok {
+			finding(LintUnknownPType, "policy type "+strconv.Quote(line.PType)+" is not defined by the model")
+			return nil
+		}
+		if want := ruleArity(ast); len(rule) != want {
+			finding(LintArity, line.PType+" rule ["+strings.Join(rule, ", ")+"] has "+
+				strconv.Itoa(len(rule))+" values, the model defines "+strconv.Itoa(want))
+			return nil
+		}
+
+		switch {
+		case strings.HasPrefix(line.PType, "p"):
+			granted[rule[0]] = true
+		case line.PType == "g":
+			parents[rule[0]] = append(parents[rule[0]], rule[1])
+			assignments = append(assignments, line)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reported := map[string]bool{}
+	for _, line := range assignments {
+		rule := line.toStringPolicy()
+		role := rule[1]
+		if reported[role] || grants(role, granted, parents, map[string]bool{}) {
+			continue
+		}
+		reported[role] = true
+		findings = append(findings, LintFinding{
+			Kind:    LintOrphanRole,
+			PType:   line.PType,
+			Rule:    rule,
+			Message: "role " + strconv.Quote(role) + " has no p rules and inherits none",
+		})
+	}
+	return findings, nil
+}
+
+// grants reports whether role has "p" rules of its own or inherits from a
+// role that has.
+func grants(role string, granted map[string]bool, parents map[string][]string, visited map[string]bool) bool {
+	if granted[role] {
+		return true
+	}
+	if visited[role] {
+		return false
+	}
+	visited[role] = true
+	for _, parent := range parents[role] {
+		if grants(parent, granted, parents, visited) {
+			return true
+		}
+	}
+	return false
+}
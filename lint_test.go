@@ -0,0 +1,69 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestAdapterLintPolicies(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_lint")
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	m := newModel(t, "examples/rbac_model.conf")
+	findings, err := a.LintPolicies(m)
+	if err != nil {
+		t.Fatalf("Expected LintPolicies() to be successful; got %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("Expected no findings for a clean policy; got %v", findings)
+	}
+
+	if err := a.AddPolicy("p", "p2", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"bob", "data1"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("g", "g", []string{"carol", "auditor"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("g", "g", []string{"dave", "data2_admin"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("g", "g", []string{"dave", "data2_admin"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	findings, err = a.LintPolicies(m)
+	if err != nil {
+		t.Fatalf("Expected LintPolicies() to be successful; got %v", err)
+	}
+	kinds := map[LintKind]int{}
+	for _, f := range findings {
+		kinds[f.Kind]++
+	}
+	want := map[LintKind]int{LintUnknownPType: 1, LintArity: 1, LintOrphanRole: 1, LintDuplicate: 1}
+	for kind, n := range want {
+		if kinds[kind] != n {
+			t.Errorf("Expected %d %s findings; got %v", n, kind, findings)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SaveLock is a lease on saving the policy, see AcquireSaveLock.
+type SaveLock struct {
+	adapter *Adapter
+	expires time.Time
+}
+
+// leaseDoc is the document recording who holds the save lock of a tenant,
+// and until when.
+type leaseDoc struct {
+	ID      string    `bson:"_id"`
+	Holder  string    `bson:"holder"`
+	Expires time.Time `bson:"expires_at"`
+}
+
+// AcquireSaveLock takes the save lock of the policy for ttl, so that only one
+// of several processes sharing the policy saves it, for example when all
+// replicas of a service save the policy on startup. It fails with
+// ErrSaveLocked if another adapter holds the lock; an adapter that holds the
+// lock already extends it, but never shortens it. The lock expires after ttl
+// unless it is released or acquired again before, so a crashed holder does
+// not block the others for longer. The lock of a tenant, see WithTenant,
+// only excludes other holders of that tenant's lock, and the lock of an
+// unscoped adapter excludes the holders of every tenant's lock. Leases are
+// compared using the clocks of the processes, which must therefore be
+// synchronized.
+//
+// The lock is advisory: it only excludes other holders of the lock, see
+// WithSaveLock. The leases are kept in a collection named after the policy
+// collection with a "_locks" suffix.
+func (a *Adapter) AcquireSaveLock(ctx context.Context, ttl time.Duration) (*SaveLock, error) {
+	if ttl <= 0 {
+		return nil, errors.New("lock duration must be positive")
+	}
+
+	expires, _, err := a.acquireLease(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &SaveLock{adapter: a, expires: expires}, nil
+}
+
+// Expires returns the time the lock expires unless it is acquired again.
+func (l *SaveLock) Expires() time.Time {
+	return l.expires
+}
+
+// Release gives up the lock, if it is still held.
+func (l *SaveLock) Release(ctx context.Context) error {
+	return l.adapter.releaseLease(ctx)
+}
+
+// locks returns the collection holding the leases.
+func (a *Adapter) locks() *mongo.Collection {
+	return a.collection.Database().Collection(a.collectionName+"_locks", a.collectionOptions())
+}
+
+// acquireLease takes or extends the save lease of the adapter's tenant, and
+// reports whether the adapter held it already. A lease that is held is
+// never shortened.
+func (a *Adapter) acquireLease(ctx context.Context, ttl time.Duration) (time.Time, bool, error) {
+	now := time.Now()
+	expires := now.Add(ttl)
+
+	var before leaseDoc
+	err := a.locks().FindOneAndUpdate(ctx,
+		bson.M{"_id": a.leaseID(), "$or": bson.A{
+			bson.M{"holder": a.lockHolder},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		}},
+		bson.M{"$set": bson.M{"holder": a.lockHolder}, "$max": bson.M{"expires_at": expires}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before),
+	).Decode(&before)
+	held := false
+	switch {
+	case err == mongo.ErrNoDocuments:
+		// The lease did not exist yet.
+	case mongo.IsDuplicateKeyError(err):
+		// The lease exists, but it is held by someone else.
+		return time.Time{}, false, ErrSaveLocked
+	case err != nil:
+		return time.Time{}, false, err
+	default:
+		held = before.Holder == a.lockHolder && before.Expires.After(now)
+		if held && before.Expires.After(expires) {
+			expires = before.Expires
+		}
+	}
+
+	if !held {
+		if err := a.checkLeases(ctx, now); err != nil {
+			if err := a.releaseLease(context.Background()); err != nil {
+				a.debug("releasing save lock failed", "lock", a.leaseID(), "error", err)
+			}
+			return time.Time{}, false, err
+		}
+	}
+
+	a.debug("acquired save lock", "lock", a.leaseID(), "expires", expires)
+	return expires, held, nil
+}
+
+// checkLeases fails with ErrSaveLocked if another adapter holds a lease that
+// overlaps the lease of the adapter's tenant: the lease of an unscoped
+// adapter overlaps the leases of all tenants. Both sides take their own lease
+// before they check the other's, so at least one of them backs off.
+func (a *Adapter) checkLeases(ctx context.Context, now time.Time) error {
+	var id interface{} = unscopedLeaseID
+	if a.tenant == "" {
+		id = bson.M{"$regex": "^" + regexp.QuoteMeta(unscopedLeaseID) + "."}
+	}
+	err := a.locks().FindOne(ctx, bson.M{
+		"_id":        id,
+		"holder":     bson.M{"$ne": a.lockHolder},
+		"expires_at": bson.M{"$gt": now},
+	}).Err()
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil
+	case err != nil:
+		return err
+	default:
+		return ErrSaveLocked
+	}
+}
+
+// releaseLease gives up the save lease, if the adapter holds it.
+func (a *Adapter) releaseLease(ctx context.Context) error {
+	_, err := a.locks().DeleteOne(ctx, bson.M{"_id": a.leaseID(), "holder": a.lockHolder})
+	return err
+}
+
+// unscopedLeaseID is the _id of the lease of an unscoped adapter, which is
+// also the prefix of the leases of the tenants.
+const unscopedLeaseID = "save/"
+
+// leaseID returns the _id of the lease of the adapter's tenant.
+func (a *Adapter) leaseID() string {
+	return unscopedLeaseID + a.tenant
+}
+
+// lockSave takes the save lock for SavePolicy, see WithSaveLock, and returns
+// the function that releases it, unless it was held before.
+func (a *Adapter) lockSave(ctx context.Context) (func(), error) {
+	_, held, err := a.acquireLease(ctx, a.saveLockTTL)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		// Leave the lock to whoever acquired it explicitly.
+		return func() {}, nil
+	}
+	return func() {
+		if err := a.releaseLease(context.Background()); err != nil {
+			a.debug("releasing save lock failed", "lock", a.leaseID(), "error", err)
+		}
+	}, nil
+}
+
+// newLockHolder returns a new identity for an adapter holding save locks.
+func newLockHolder() string {
+	return primitive.NewObjectID().Hex()
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSaveLock(t *testing.T) {
+	ctx := context.Background()
+	first := newTestAdapter(t, "casbin_rule_locked")
+	defer first.locks().Drop(ctx)
+
+	second := newTestAdapter(t, "casbin_rule_locked", WithSaveLock(time.Minute))
+
+	lock, err := first.AcquireSaveLock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected AcquireSaveLock() to be successful; got %v", err)
+	}
+	if _, err := first.AcquireSaveLock(ctx, time.Minute); err != nil {
+		t.Errorf("Expected the holder to extend the lock; got %v", err)
+	}
+	if _, err := second.AcquireSaveLock(ctx, time.Minute); !errors.Is(err, ErrSaveLocked) {
+		t.Errorf("Expected ErrSaveLocked; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := second.SavePolicy(e.GetModel()); !errors.Is(err, ErrSaveLocked) {
+		t.Errorf("Expected SavePolicy() to fail with ErrSaveLocked; got %v", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Errorf("Expected Release() to be successful; got %v", err)
+	}
+	if err := second.SavePolicy(e.GetModel()); err != nil {
+		t.Errorf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	// The save released its lock.
+	if _, err := first.AcquireSaveLock(ctx, time.Minute); err != nil {
+		t.Errorf("Expected the lock to be free; got %v", err)
+	}
+
+	// Acquiring the lock again never shortens it.
+	long, err := first.AcquireSaveLock(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected AcquireSaveLock() to be successful; got %v", err)
+	}
+	short, err := first.AcquireSaveLock(ctx, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected AcquireSaveLock() to be successful; got %v", err)
+	}
+	if short.Expires().Before(long.Expires().Add(-time.Second)) {
+		t.Errorf("Expected the lock to expire at %v; got %v", long.Expires(), short.Expires())
+	}
+
+	// The unscoped lock excludes the locks of tenants, and the other way round.
+	tenant := newTestAdapter(t, "casbin_rule_locked", WithTenant("acme"))
+	if _, err := tenant.AcquireSaveLock(ctx, time.Minute); !errors.Is(err, ErrSaveLocked) {
+		t.Errorf("Expected ErrSaveLocked for a tenant; got %v", err)
+	}
+	if err := short.Release(ctx); err != nil {
+		t.Errorf("Expected Release() to be successful; got %v", err)
+	}
+	if _, err := tenant.AcquireSaveLock(ctx, time.Minute); err != nil {
+		t.Errorf("Expected AcquireSaveLock() of a tenant to be successful; got %v", err)
+	}
+	if _, err := first.AcquireSaveLock(ctx, time.Minute); !errors.Is(err, ErrSaveLocked) {
+		t.Errorf("Expected ErrSaveLocked while a tenant holds its lock; got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+// Logger receives the debug logs of the adapter, see WithLogger. The
+// arguments following the message are alternating keys and values, as
+// expected by *slog.Logger, which implements Logger, and by the Debugw method
+// of zap's SugaredLogger. Other loggers, such as logrus, need a small
+// wrapper.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+}
+
+// debug logs a message if the adapter has a logger.
+func (a *Adapter) debug(msg string, keysAndValues ...interface{}) {
+	if a.logger != nil {
+		a.logger.Debug(msg, keysAndValues...)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	mu       sync.Mutex
+	messages map[string]int
+}
+
+func (l *testLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages[msg]++
+}
+
+func TestLogger(t *testing.T) {
+	initPolicy(t)
+
+	l := &testLogger{messages: map[string]int{}}
+	a := newTestAdapter(t, defaultCollectionName, WithLogger(l))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.AddPolicy("carol", "data3", "read")
+	e.RemovePolicy("carol", "data3", "read")
+
+	for _, msg := range []string{"creating indexes", "finding rules", "inserted rules", "deleted rules", "operation finished"} {
+		if l.messages[msg] == 0 {
+			t.Errorf("Expected a %q log; got %v", msg, l.messages)
+		}
+	}
+}
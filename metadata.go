@@ -0,0 +1,109 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errMetadataDisabled is returned by the metadata operations unless
+// WithMetadata is given.
+var errMetadataDisabled = errors.New("metadata is not enabled")
+
+// AddPolicyWithMeta adds a policy rule to the storage like AddPolicy, along
+// with metadata such as its owner, a ticket ID or a note on when it should
+// expire. The metadata is returned by GetPolicyMeta and ListPolicies, and is
+// never loaded into the model. It requires WithMetadata.
+func (a *Adapter) AddPolicyWithMeta(sec string, ptype string, rule []string, meta map[string]string) error {
+	return a.AddPolicyWithMetaCtx(context.Background(), sec, ptype, rule, meta)
+}
+
+// AddPolicyWithMetaCtx is like AddPolicyWithMeta but honors the deadline and cancellation of ctx.
+func (a *Adapter) AddPolicyWithMetaCtx(ctx context.Context, sec string, ptype string, rule []string, meta map[string]string) (err error) {
+	ctx, end := a.begin(ctx, "AddPolicyWithMeta")
+	defer func() { err = end(err) }()
+
+	if !a.metadata {
+		return errMetadataDisabled
+	}
+	if err := a.validateRule(ptype, rule); err != nil {
+		return err
+	}
+
+	line := a.ruleLine(ptype, rule)
+	line.Meta = meta
+	if line.Meta == nil {
+		line.Meta = map[string]string{}
+	}
+	return a.addLine(ctx, line)
+}
+
+// GetPolicyMeta returns the metadata stored with the rule, which is empty if
+// the rule was added without any. It fails with ErrRuleNotFound if the rule
+// is not stored. It requires WithMetadata.
+func (a *Adapter) GetPolicyMeta(sec string, ptype string, rule []string) (map[string]string, error) {
+	return a.GetPolicyMetaCtx(context.Background(), sec, ptype, rule)
+}
+
+// GetPolicyMetaCtx is like GetPolicyMeta but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetPolicyMetaCtx(ctx context.Context, sec string, ptype string, rule []string) (meta map[string]string, err error) {
+	ctx, end := a.begin(ctx, "GetPolicyMeta")
+	defer func() { err = end(err) }()
+
+	if !a.metadata {
+		return nil, errMetadataDisabled
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{a.schema.Meta: 1})
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
+	}
+	doc, err := a.collection.FindOne(ctx, a.selector(a.ruleLine(ptype, rule)), opts).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meta = a.decodeMeta(doc)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	return meta, nil
+}
+
+// decodeMeta reads the metadata of a stored rule, or nil if it has none.
+// Values that are not strings are skipped.
+func (a *Adapter) decodeMeta(doc bson.Raw) map[string]string {
+	fields, ok := doc.Lookup(a.schema.Meta).DocumentOK()
+	if !ok {
+		return nil
+	}
+	elems, _ := fields.Elements()
+
+	meta := make(map[string]string, len(elems))
+	for _, e := range elems {
+		if v, ok := e.Value().StringValueOK(); ok {
+			meta[e.Key()] = v
+		}
+	}
+	return meta
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPolicyMetadata(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_metadata", WithMetadata())
+
+	meta := map[string]string{"owner": "team-a", "ticket": "SEC-42"}
+	if err := a.AddPolicyWithMeta("p", "p", []string{"alice", "data1", "read"}, meta); err != nil {
+		t.Fatalf("Expected AddPolicyWithMeta() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	got, err := a.GetPolicyMeta("p", "p", []string{"alice", "data1", "read"})
+	if err != nil || got["owner"] != "team-a" || got["ticket"] != "SEC-42" || len(got) != 2 {
+		t.Errorf("Expected GetPolicyMeta() to return %v; got %v, %v", meta, got, err)
+	}
+	if got, err := a.GetPolicyMeta("p", "p", []string{"bob", "data2", "write"}); err != nil || len(got) != 0 {
+		t.Errorf("Expected GetPolicyMeta() to return no metadata; got %v, %v", got, err)
+	}
+	if _, err := a.GetPolicyMeta("p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("Expected GetPolicyMeta() to fail with ErrRuleNotFound; got %v", err)
+	}
+
+	// The metadata is invisible to the model, and survives a save.
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	page, err := a.ListPolicies(nil, 0, 0, "v0")
+	if err != nil {
+		t.Fatalf("Expected ListPolicies() to be successful; got %v", err)
+	}
+	if len(page.Meta) != 2 || page.Meta[0]["owner"] != "team-a" || page.Meta[1] != nil {
+		t.Errorf("Unexpected metadata: %v", page.Meta)
+	}
+
+	b := newTestAdapter(t, "casbin_rule_metadata")
+	defer b.Close()
+	if err := b.AddPolicyWithMeta("p", "p", []string{"carol", "data3", "read"}, meta); err == nil {
+		t.Error("Expected AddPolicyWithMeta() to fail without WithMetadata")
+	}
+}
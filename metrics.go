@@ -0,0 +1,36 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import "time"
+
+// Metrics receives measurements of the adapter's operations, for example to
+// export them to Prometheus, see WithMetrics. Its methods are called
+// synchronously and must be safe for concurrent use.
+type Metrics interface {
+	// ObserveOperation is called after each operation with its name, such
+	// as "LoadPolicy" or "AddPolicy", its duration and its error, if any.
+	ObserveOperation(op string, duration time.Duration, err error)
+	// ObserveRulesLoaded is called after each successful load with the
+	// number of rules read.
+	ObserveRulesLoaded(op string, rules int)
+}
+
+// rulesLoaded reports the number of rules read by a load.
+func (a *Adapter) rulesLoaded(op string, rules int) {
+	if a.metrics != nil {
+		a.metrics.ObserveRulesLoaded(op, rules)
+	}
+}
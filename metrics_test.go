@@ -0,0 +1,105 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testMetrics struct {
+	mu     sync.Mutex
+	ops    map[string]int
+	errors int
+	rules  int
+}
+
+func (m *testMetrics) ObserveOperation(op string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[op]++
+	if err != nil {
+		m.errors++
+	}
+}
+
+func (m *testMetrics) ObserveRulesLoaded(op string, rules int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules += rules
+}
+
+func TestMetrics(t *testing.T) {
+	initPolicy(t)
+
+	m := &testMetrics{ops: map[string]int{}}
+	a := newTestAdapter(t, defaultCollectionName, WithMetrics(m))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.AddPolicy("carol", "data3", "read")
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	a.UpdatePolicies("p", "p", [][]string{{"carol", "data3", "read"}}, nil)
+
+	if m.ops["LoadPolicy"] != 2 || m.ops["AddPolicy"] != 1 || m.ops["UpdatePolicies"] != 1 {
+		t.Errorf("Unexpected operations: %v", m.ops)
+	}
+	if m.errors != 1 {
+		t.Errorf("Expected 1 failed operation; got %d", m.errors)
+	}
+	// The enforcer loads the initial policy of 5 rules, and then 6.
+	if m.rules != 11 {
+		t.Errorf("Expected 11 rules loaded; got %d", m.rules)
+	}
+}
+
+type slowMetrics struct {
+	testMetrics
+	slow []SlowOperation
+}
+
+func (m *slowMetrics) ObserveSlowOperation(op SlowOperation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slow = append(m.slow, op)
+}
+
+func TestSlowOperations(t *testing.T) {
+	initPolicy(t)
+
+	m := &slowMetrics{testMetrics: testMetrics{ops: map[string]int{}}}
+	a := newTestAdapter(t, defaultCollectionName, WithMetrics(m), WithSlowOperationThreshold(time.Nanosecond))
+
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "data2_admin"); err != nil {
+		t.Errorf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+	newEnforcer(t, "examples/rbac_model.conf", a)
+
+	if len(m.slow) != 2 {
+		t.Fatalf("Expected 2 slow operations; got %v", m.slow)
+	}
+	if op := m.slow[0]; op.Operation != "RemoveFilteredPolicy" || op.Documents != 2 || op.Shape != `{"ptype":"?","v0":"?"}` {
+		t.Errorf("Unexpected slow operation: %+v", op)
+	}
+	if op := m.slow[1]; op.Operation != "LoadPolicy" || op.Documents != 3 {
+		t.Errorf("Unexpected slow operation: %+v", op)
+	}
+
+	if _, err := NewAdapterWithError(getDbURL(), WithSlowOperationThreshold(0)); err == nil {
+		t.Error("Expected NewAdapterWithError() to reject a threshold of 0")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// migrateBatchSize is the number of rules MigrateFrom and Replicate write
+// between two progress reports, unless WithInsertBatchSize is given.
+const migrateBatchSize = 1000
+
+// MigrateFrom copies the policy of another adapter, such as the file, gorm or
+// xorm adapter, into MongoDB, replacing the stored rules. The source policy is
+// loaded into m, which must define the policy types to copy, for example a
+// model created from the model.conf of the application; any policy m holds is
+// discarded. If progress is not nil, it is called after each batch of rules
+// is written, with the number of rules written so far and the total. With
+// WithTransactions, the stored rules are replaced atomically.
+func (a *Adapter) MigrateFrom(source persist.Adapter, m model.Model, progress func(written, total int)) error {
+	return a.MigrateFromCtx(context.Background(), source, m, progress)
+}
+
+// MigrateFromCtx is like MigrateFrom but honors the deadline and cancellation of ctx.
+func (a *Adapter) MigrateFromCtx(ctx context.Context, source persist.Adapter, m model.Model, progress func(written, total int)) (err error) {
+	ctx, end := a.begin(ctx, "MigrateFrom")
+	defer func() { err = end(err) }()
+
+	if source == nil || m == nil {
+		return errors.New("source adapter and model must not be nil")
+	}
+
+	m.ClearPolicy()
+	if err := source.LoadPolicy(m); err != nil {
+		return err
+	}
+	if err := a.validateModel(m); err != nil {
+		return err
+	}
+
+	var docs []interface{}
+	for _, ptype := range policyTypes(m) {
+		for _, rule := range findAssertion(m, ptype).Policy {
+			docs = append(docs, a.document(a.ruleLine(ptype, rule)))
+		}
+	}
+
+	batch := a.progressBatch()
+
+	return a.withHistory(ctx, change{op: "import"}, func(ctx context.Context) error {
+		if err := a.deleteMany(ctx, a.scope(bson.M{})); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(0, len(docs))
+		}
+
+		for i := 0; i < len(docs); i += batch {
+			end := i + batch
+			if end > len(docs) {
+				end = len(docs)
+			}
+			if err := a.insertMany(ctx, a.collection, docs[i:end]); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(end, len(docs))
+			}
+		}
+		return nil
+	})
+}
+
+// progressBatch returns the number of rules to write between two progress
+// reports, enough to keep all insert workers busy.
+func (a *Adapter) progressBatch() int {
+	if a.insertBatch <= 0 {
+		return migrateBatchSize
+	}
+	if a.insertWorkers > 1 {
+		return a.insertBatch * a.insertWorkers
+	}
+	return a.insertBatch
+}
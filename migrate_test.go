@@ -0,0 +1,47 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+func TestMigrateFrom(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_migrated", WithInsertBatchSize(2))
+
+	if err := a.AddPolicy("p", "p", []string{"mallory", "data1", "write"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	var reports [][2]int
+	source := fileadapter.NewAdapter("examples/rbac_policy.csv")
+	err := a.MigrateFrom(source, newModel(t, "examples/rbac_model.conf"), func(written, total int) {
+		reports = append(reports, [2]int{written, total})
+	})
+	if err != nil {
+		t.Fatalf("Expected MigrateFrom() to be successful; got %v", err)
+	}
+	if len(reports) != 4 || reports[3] != [2]int{5, 5} {
+		t.Errorf("Expected progress after each batch of 2 rules; got %v", reports)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	if found, _ := e.HasGroupingPolicy("alice", "data2_admin"); !found {
+		t.Errorf("Expected the role assignment to be migrated")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// schemaVersionID is the _id of the document holding the schema version of
+// the policy collection.
+const schemaVersionID = "schema_version"
+
+// A Migration changes the documents of the policy collection from one
+// version of their schema to the next, see WithMigrations.
+type Migration struct {
+	// Version is the schema version the migration migrates to. Versions
+	// start at 1 and increase in the order of the migrations.
+	Version int
+	// Description tells what the migration does, for logs.
+	Description string
+	// Up migrates the documents of the policy collection to Version.
+	Up func(ctx context.Context, rules *mongo.Collection) error
+	// Down, if set, reverts Up, see RollbackSchema.
+	Down func(ctx context.Context, rules *mongo.Collection) error
+}
+
+// WithMigrations runs the migrations the policy collection has not seen yet
+// when the adapter connects, in order. The version of the last migration run
+// is stamped on the collection, in a document of a collection named after
+// the policy collection with a "_meta" suffix. Adapters starting at the same
+// time may run a migration twice, so migrations must be idempotent, such as
+// updates that only match documents not migrated yet. See PendingMigrations
+// to check what would run, and RollbackSchema to revert migrations.
+func WithMigrations(migrations ...Migration) Option {
+	return func(a *Adapter) error {
+		version := 0
+		for _, m := range migrations {
+			if m.Version <= version {
+				return errors.New("migration versions must be positive and increasing: " + strconv.Itoa(m.Version))
+			}
+			if m.Up == nil {
+				return errors.New("migration " + strconv.Itoa(m.Version) + " has no Up function")
+			}
+			version = m.Version
+		}
+		a.migrations = migrations
+		return nil
+	}
+}
+
+// meta returns the collection holding the schema version.
+func (a *Adapter) meta() *mongo.Collection {
+	return a.collection.Database().Collection(a.collectionName+"_meta", a.collectionOptions())
+}
+
+// SchemaVersion returns the schema version stamped on the policy collection,
+// or 0 if no migration has run, see WithMigrations.
+func (a *Adapter) SchemaVersion() (int, error) {
+	return a.SchemaVersionCtx(context.Background())
+}
+
+// SchemaVersionCtx is like SchemaVersion but honors the deadline and cancellation of ctx.
+func (a *Adapter) SchemaVersionCtx(ctx context.Context) (version int, err error) {
+	ctx, end := a.begin(ctx, "SchemaVersion")
+	defer func() { err = end(err) }()
+
+	return a.schemaVersion(ctx)
+}
+
+func (a *Adapter) schemaVersion(ctx context.Context) (int, error) {
+	var doc struct {
+		Version int `bson:"version"`
+	}
+	err := a.meta().FindOne(ctx, bson.M{"_id": schemaVersionID}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return doc.Version, err
+}
+
+// stampVersion records that the schema moved from version from to version
+// to. It reports false if another adapter changed the version in between.
+func (a *Adapter) stampVersion(ctx context.Context, from, to int) (bool, error) {
+	selector := bson.M{"_id": schemaVersionID, "version": from}
+	if from == 0 {
+		selector = bson.M{"_id": schemaVersionID, "version": bson.M{"$in": bson.A{0, nil}}}
+	}
+	res, err := a.meta().UpdateOne(ctx, selector,
+		bson.M{"$set": bson.M{"version": to, "updated_at": time.Now()}},
+		options.Update().SetUpsert(from == 0))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount+res.UpsertedCount > 0, nil
+}
+
+// PendingMigrations returns the migrations that would run on the policy
+// collection, without running them.
+func (a *Adapter) PendingMigrations() ([]Migration, error) {
+	return a.PendingMigrationsCtx(context.Background())
+}
+
+// PendingMigrationsCtx is like PendingMigrations but honors the deadline and cancellation of ctx.
+func (a *Adapter) PendingMigrationsCtx(ctx context.Context) (pending []Migration, err error) {
+	ctx, end := a.begin(ctx, "PendingMigrations")
+	defer func() { err = end(err) }()
+
+	version, err := a.schemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.pendingMigrations(version), nil
+}
+
+func (a *Adapter) pendingMigrations(version int) []Migration {
+	pending := []Migration{}
+	for _, m := range a.migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// migrateSchema runs the pending migrations, see WithMigrations.
+func (a *Adapter) migrateSchema(ctx context.Context) error {
+	version, err := a.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range a.pendingMigrations(version) {
+		a.debug("migrating schema", "collection", a.collectionName, "version", m.Version, "description", m.Description)
+		if err := m.Up(ctx, a.collection); err != nil {
+			return errors.New("migration " + strconv.Itoa(m.Version) + " failed: " + err.Error())
+		}
+		ok, err := a.stampVersion(ctx, version, m.Version)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Another adapter is migrating; it runs the rest.
+			return nil
+		}
+		version = m.Version
+	}
+	return nil
+}
+
+// RollbackSchema reverts the migrations above version, latest first, by
+// running their Down functions, and stamps version on the policy collection.
+// It fails without changes if one of them has no Down function.
+func (a *Adapter) RollbackSchema(version int) error {
+	return a.RollbackSchemaCtx(context.Background(), version)
+}
+
+// RollbackSchemaCtx is like RollbackSchema but honors the deadline and cancellation of ctx.
+func (a *Adapter) RollbackSchemaCtx(ctx context.Context, version int) (err error) {
+	ctx, end := a.begin(ctx, "RollbackSchema")
+	defer func() { err = end(err) }()
+
+	current, err := a.schemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	var steps []Migration
+	for i := len(a.migrations) - 1; i >= 0; i-- {
+		m := a.migrations[i]
+		if m.Version <= version || m.Version > current {
+			continue
+		}
+		if m.Down == nil {
+			return errors.New("migration " + strconv.Itoa(m.Version) + " cannot be rolled back")
+		}
+		steps = append(steps, m)
+	}
+
+	for i, m := range steps {
+		a.debug("rolling back schema", "collection", a.collectionName, "version", m.Version, "description", m.Description)
+		if err := m.Down(ctx, a.collection); err != nil {
+			return errors.New("rolling back migration " + strconv.Itoa(m.Version) + " failed: " + err.Error())
+		}
+		to := version
+		if i+1 < len(steps) {
+			to = steps[i+1].Version
+		}
+		ok, err := a.stampVersion(ctx, current, to)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("schema version changed during rollback")
+		}
+		current = to
+	}
+	a.InvalidateCache()
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tagMigration tags every rule, and removes the tag again on rollback.
+var tagMigration = Migration{
+	Version:     1,
+	Description: "tag the rules",
+	Up: func(ctx context.Context, rules *mongo.Collection) error {
+		_, err := rules.UpdateMany(ctx, bson.M{"tag": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"tag": "migrated"}})
+		return err
+	},
+	Down: func(ctx context.Context, rules *mongo.Collection) error {
+		_, err := rules.UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"tag": ""}})
+		return err
+	},
+}
+
+func TestAdapterWithMigrations(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_migrations")
+	defer a.meta().Drop(context.Background())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	// Listing the pending migrations does not run them.
+	dry := newTestAdapter(t, "casbin_rule_migrations")
+	defer dry.Close()
+	dry.migrations = []Migration{tagMigration}
+	pending, err := dry.PendingMigrations()
+	if err != nil {
+		t.Fatalf("Expected PendingMigrations() to be successful; got %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 1 {
+		t.Errorf("Expected migration 1 to be pending; got %v", pending)
+	}
+	if n, _ := a.collection.CountDocuments(context.Background(), bson.M{"tag": "migrated"}); n != 0 {
+		t.Errorf("Expected no rule to be migrated; got %d", n)
+	}
+
+	migrated := newTestAdapter(t, "casbin_rule_migrations", WithMigrations(tagMigration))
+	defer migrated.Close()
+	if version, err := migrated.SchemaVersion(); err != nil || version != 1 {
+		t.Errorf("Expected SchemaVersion() to be 1; got %d, %v", version, err)
+	}
+	if n, _ := a.collection.CountDocuments(context.Background(), bson.M{"tag": bson.M{"$ne": "migrated"}}); n != 0 {
+		t.Errorf("Expected every rule to be migrated; got %d left", n)
+	}
+	if pending, err := migrated.PendingMigrations(); err != nil || len(pending) != 0 {
+		t.Errorf("Expected no pending migrations; got %v, %v", pending, err)
+	}
+
+	if err := migrated.RollbackSchema(0); err != nil {
+		t.Fatalf("Expected RollbackSchema() to be successful; got %v", err)
+	}
+	if version, err := migrated.SchemaVersion(); err != nil || version != 0 {
+		t.Errorf("Expected SchemaVersion() to be 0; got %d, %v", version, err)
+	}
+	if n, _ := a.collection.CountDocuments(context.Background(), bson.M{"tag": bson.M{"$exists": true}}); n != 0 {
+		t.Errorf("Expected the tags to be removed; got %d left", n)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+}
+
+func TestWithMigrationsOrder(t *testing.T) {
+	second := tagMigration
+	second.Version = 2
+	if _, err := NewAdapterWithError(getDbURL(), WithMigrations(second, tagMigration)); err == nil {
+		t.Errorf("Expected NewAdapterWithError() to fail for unordered migrations")
+	}
+}
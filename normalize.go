@@ -0,0 +1,99 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A Normalizer rewrites a rule value before it is stored or used to select
+// rules, see WithNormalization. The field names the position of the value,
+// "ptype" or "v0" to "v5" and beyond.
+type Normalizer func(field, value string) string
+
+// TrimSpace returns a Normalizer removing leading and trailing white space
+// from all values.
+func TrimSpace() Normalizer {
+	return func(field, value string) string {
+		return strings.TrimSpace(value)
+	}
+}
+
+// LowerCase returns a Normalizer lowercasing the values of the given fields,
+// such as "v0" for the subjects of the rules. Without fields, it lowercases
+// all values, including the policy type.
+func LowerCase(fields ...string) Normalizer {
+	lower := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		lower[field] = true
+	}
+	return func(field, value string) string {
+		if len(lower) > 0 && !lower[field] {
+			return value
+		}
+		return strings.ToLower(value)
+	}
+}
+
+// WithNormalization passes the policy type and values of every rule through
+// the normalizers in order before it is stored, such as TrimSpace and
+// LowerCase("v0"), so that "alice " and "Alice" do not end up as separate
+// rules. The values of filters, removals and updates are normalized alike.
+// Rules stored earlier are not rewritten, and the policy of an enforcer keeps
+// the values as given until it is loaded again.
+func WithNormalization(normalizers ...Normalizer) Option {
+	return func(a *Adapter) error {
+		for _, n := range normalizers {
+			if n == nil {
+				return errors.New("normalizer must not be nil")
+			}
+		}
+		a.normalizers = append(a.normalizers, normalizers...)
+		return nil
+	}
+}
+
+// normalize passes the value at position index, -1 for the policy type,
+// through the normalizers in order.
+func (a *Adapter) normalize(index int, value string) string {
+	if len(a.normalizers) == 0 {
+		return value
+	}
+
+	field := "ptype"
+	if index >= 0 {
+		field = "v" + strconv.Itoa(index)
+	}
+	for _, n := range a.normalizers {
+		value = n(field, value)
+	}
+	return value
+}
+
+// normalizeRule returns the normalized policy type and values of a rule,
+// leaving rule itself alone.
+func (a *Adapter) normalizeRule(ptype string, rule []string) (string, []string) {
+	if len(a.normalizers) == 0 {
+		return ptype, rule
+	}
+
+	values := make([]string, len(rule))
+	for i, v := range rule {
+		values[i] = a.normalize(i, v)
+	}
+	return a.normalize(-1, ptype), values
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestAdapterWithNormalization(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_normalize", WithNormalization(TrimSpace(), LowerCase("v0")), WithDuplicates(DuplicatesIgnore))
+
+	for _, rule := range [][]string{{"alice", "data1", "read"}, {" Alice ", "data1", "read"}, {"bob", " Data2", "write"}} {
+		if err := a.AddPolicy("p", "p", rule); err != nil {
+			t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+		}
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "Data2", "write"}})
+
+	// Filters and removals are normalized alike.
+	if err := e.LoadFilteredPolicy(&Filter{V0: []string{"BOB "}}); err != nil {
+		t.Errorf("Expected LoadFilteredPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "Data2", "write"}})
+
+	if err := a.RemovePolicy("p", "p", []string{"ALICE", "data1 ", "read"}); err != nil {
+		t.Errorf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	if err := a.RemoveFilteredPolicy("p", "p", 0, "Bob"); err != nil {
+		t.Errorf("Expected RemoveFilteredPolicy() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{})
+}
@@ -0,0 +1,876 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultDatabaseName   = "casbin"
+	defaultCollectionName = "casbin_rule"
+)
+
+// ruleFields are the document fields of a CasbinRule, in rule order.
+var ruleFields = []string{"ptype", "v0", "v1", "v2", "v3", "v4", "v5"}
+
+// IndexCreation controls whether the adapter creates its indexes.
+type IndexCreation int
+
+const (
+	// IndexCreationRequired creates the indexes and fails the constructor if
+	// that is not possible. This is the default.
+	IndexCreationRequired IndexCreation = iota
+	// IndexCreationBestEffort creates the indexes, but tolerates a user who
+	// lacks the privilege to do so.
+	IndexCreationBestEffort
+	// IndexCreationDisabled never creates indexes, leaving them to the
+	// database administrator.
+	IndexCreationDisabled
+)
+
+// DuplicateMode controls how AddPolicy and AddPolicies handle a rule that is
+// stored already.
+type DuplicateMode int
+
+const (
+	// DuplicatesAllow stores the rule again. This is the default.
+	DuplicatesAllow DuplicateMode = iota
+	// DuplicatesReject fails with ErrDuplicateRule.
+	DuplicatesReject
+	// DuplicatesIgnore leaves the stored rule alone and reports success.
+	DuplicatesIgnore
+)
+
+// Option configures an Adapter. Options are applied in order by the
+// constructors, before the adapter connects to the server.
+type Option func(*Adapter) error
+
+// WithDatabase sets the name of the database holding the policy. It takes
+// precedence over the database given in the URL.
+func WithDatabase(name string) Option {
+	return func(a *Adapter) error {
+		if name == "" {
+			return errors.New("database name must not be empty")
+		}
+		a.databaseName = name
+		return nil
+	}
+}
+
+// WithCollection sets the name of the collection holding the policy. The
+// default is "casbin_rule".
+func WithCollection(name string) Option {
+	return func(a *Adapter) error {
+		if name == "" {
+			return errors.New("collection name must not be empty")
+		}
+		a.collectionName = name
+		return nil
+	}
+}
+
+// WithFieldIndexes selects the rule fields ("ptype", "v0" to "v5") that get a
+// single-field index. By default every field is indexed; calling it without
+// fields disables the single-field indexes.
+func WithFieldIndexes(fields ...string) Option {
+	return func(a *Adapter) error {
+		for _, field := range fields {
+			if !isRuleField(field) {
+				return errors.New("unknown rule field: " + field)
+			}
+		}
+		a.fieldIndexes = fields
+		return nil
+	}
+}
+
+// WithPartialIndexes limits the single-field indexes of v0 to v5 to the rules
+// that use the field, so that the indexes of fields most rules leave empty
+// stay small. Queries for an empty value no longer use the index. Indexes
+// created earlier without the option must be dropped first. Azure Cosmos DB
+// does not support partial indexes and keeps full ones.
+func WithPartialIndexes() Option {
+	return func(a *Adapter) error {
+		a.partialIndexes = true
+		return nil
+	}
+}
+
+// WithIndexes adds index definitions to the ones the adapter creates. The keys
+// name the stored fields, see WithSchema. Combined with WithFieldIndexes, it
+// replaces the default indexes with ones that match the application's
+// queries.
+func WithIndexes(models ...mongo.IndexModel) Option {
+	return func(a *Adapter) error {
+		for _, model := range models {
+			if model.Keys == nil {
+				return errors.New("index definition without keys")
+			}
+		}
+		a.indexes = append(a.indexes, models...)
+		return nil
+	}
+}
+
+// WithCompoundIndex adds an index over all rule fields, which serves exact
+// rule lookups such as RemovePolicy. If unique is true, the index also keeps
+// the same rule from being stored twice; creating it fails while the
+// collection still holds duplicates.
+func WithCompoundIndex(unique bool) Option {
+	return func(a *Adapter) error {
+		a.compoundIndex = true
+		a.uniqueIndex = unique
+		return nil
+	}
+}
+
+// WithShardKey declares the fields ("ptype", "v0" to "v5" and "tenant") the
+// policy collection is sharded on, in shard key order. Sharding the
+// collection is left to the database administrator. On a sharded collection
+// SavePolicy replaces the documents in place, as sharded collections cannot
+// be renamed over, the unique compound index starts with the shard key, as
+// the server requires, and writes that store a rule unless it exists, see
+// DuplicatesIgnore, match the shard key exactly.
+func WithShardKey(fields ...string) Option {
+	return func(a *Adapter) error {
+		if len(fields) == 0 {
+			return errors.New("shard key must name at least one field")
+		}
+		for _, field := range fields {
+			if !isRuleField(field) && field != "tenant" {
+				return errors.New("unknown shard key field: " + field)
+			}
+		}
+		a.shardKey = fields
+		return nil
+	}
+}
+
+// WithCollation compares rule values using the collation, in indexes,
+// loads, filters and writes alike. For example, a strength of 2 matches
+// values case-insensitively, so RemoveFilteredPolicy removes "/Data1" along
+// with "/data1":
+//
+//	mongodbadapter.WithCollation(&options.Collation{Locale: "en", Strength: 2})
+//
+// The indexes are created with the collation, as queries only use indexes
+// of their own collation. Indexes created before without it must be dropped
+// first, or creating the indexes fails.
+func WithCollation(collation *options.Collation) Option {
+	return func(a *Adapter) error {
+		if collation == nil || collation.Locale == "" {
+			return errors.New("collation must name a locale")
+		}
+		a.collation = collation
+		return nil
+	}
+}
+
+func isRuleField(field string) bool {
+	for _, f := range ruleFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// WithCredential authenticates with the given credential instead of the one
+// in the URL, for example with an AWS IAM role, Kerberos or an X.509 client
+// certificate:
+//
+//	// AWS IAM: the credentials are read from the environment, the ECS task
+//	// role or the EC2 instance profile unless given.
+//	mongodbadapter.WithCredential(options.Credential{AuthMechanism: "MONGODB-AWS"})
+//
+//	// Kerberos.
+//	mongodbadapter.WithCredential(options.Credential{
+//		AuthMechanism:           "GSSAPI",
+//		Username:                "casbin@EXAMPLE.COM",
+//		AuthMechanismProperties: map[string]string{"SERVICE_NAME": "mongodb"},
+//	})
+//
+//	// X.509, with the client certificate set by WithTLSFiles.
+//	mongodbadapter.WithCredential(options.Credential{AuthMechanism: "MONGODB-X509"})
+//
+// The mechanisms can also be selected in the URL with authMechanism. GSSAPI
+// requires the driver to be built with the gssapi build tag. The option has no
+// effect on an adapter created with NewAdapterWithClient.
+func WithCredential(cred options.Credential) Option {
+	return func(a *Adapter) error {
+		a.credential = &cred
+		return nil
+	}
+}
+
+// WithPoolSize bounds the number of connections the adapter keeps open to
+// each server. Operations running in parallel use connections of the pool,
+// so a larger pool serves more concurrent calls; by default the driver opens
+// up to 100. It takes precedence over the pool settings of the URL. The option
+// has no effect on an adapter created with NewAdapterWithClient.
+func WithPoolSize(min, max uint64) Option {
+	return func(a *Adapter) error {
+		if max == 0 || min > max {
+			return errors.New("pool size must be positive and at least the minimum")
+		}
+		a.clientOptions = append(a.clientOptions, options.Client().SetMinPoolSize(min).SetMaxPoolSize(max))
+		return nil
+	}
+}
+
+// WithTLSConfig connects to the server over TLS using the given configuration.
+// It takes precedence over the TLS settings of the URL. The option has no
+// effect on an adapter created with NewAdapterWithClient.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(a *Adapter) error {
+		a.clientOptions = append(a.clientOptions, options.Client().SetTLSConfig(config))
+		return nil
+	}
+}
+
+// WithTLSFiles connects to the server over TLS. The server certificate is
+// verified against the PEM encoded CA bundle in caFile, or against the system
+// roots if caFile is empty. If certFile and keyFile are not empty, the key
+// pair is presented to the server as the client certificate.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(a *Adapter) error {
+		config := &tls.Config{}
+
+		if caFile != "" {
+			ca, err := os.ReadFile(caFile)
+			if err != nil {
+				return err
+			}
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(ca) {
+				return errors.New("no certificates found in " + caFile)
+			}
+		}
+
+		if certFile != "" || keyFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return err
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+
+		return WithTLSConfig(config)(a)
+	}
+}
+
+// WithIndexCreation controls whether the adapter creates its indexes. Users
+// with a read/write-only role, common on managed clusters, cannot create
+// indexes; IndexCreationBestEffort or IndexCreationDisabled let the adapter
+// run with such a role. In both modes SavePolicy rewrites the documents in
+// place rather than through a staging collection, so that indexes created by
+// an administrator are kept. Readers may then see a partial policy while a
+// save is in progress.
+func WithIndexCreation(mode IndexCreation) Option {
+	return func(a *Adapter) error {
+		if mode < IndexCreationRequired || mode > IndexCreationDisabled {
+			return errors.New("unknown index creation mode")
+		}
+		a.indexCreation = mode
+		return nil
+	}
+}
+
+// WithReadConcern sets the read concern used when loading the policy, for
+// example readconcern.Majority(). It defaults to the read concern of the
+// client.
+func WithReadConcern(rc *readconcern.ReadConcern) Option {
+	return func(a *Adapter) error {
+		a.readConcern = rc
+		return nil
+	}
+}
+
+// WithWriteConcern sets the write concern used when changing the policy, for
+// example writeconcern.Majority(). It defaults to the write concern of the
+// client.
+func WithWriteConcern(wc *writeconcern.WriteConcern) Option {
+	return func(a *Adapter) error {
+		a.writeConcern = wc
+		return nil
+	}
+}
+
+// WithReadPreference sets the members of a replica set the policy is read
+// from, for example readpref.SecondaryPreferred(). It defaults to the read
+// preference of the client.
+func WithReadPreference(rp *readpref.ReadPref) Option {
+	return func(a *Adapter) error {
+		a.readPref = rp
+		return nil
+	}
+}
+
+// WithSnapshotLoads reads the rules of LoadPolicy, LoadFilteredPolicy and
+// LoadPolicyStream in a snapshot session, so that a load spanning several
+// batches sees the rules as of a single point in time instead of some of the
+// changes made while it runs. Snapshot reads require MongoDB 5.0 or later on
+// a replica set or sharded cluster, and fail for loads that take longer than
+// the server keeps history, five minutes by default.
+func WithSnapshotLoads() Option {
+	return func(a *Adapter) error {
+		a.snapshotLoads = true
+		return nil
+	}
+}
+
+// WithSecondaryLoads loads the policy from a secondary member of the replica
+// set if one is available, and from the primary otherwise, while writes keep
+// going to the primary. A secondary that lags the primary by more than
+// maxStaleness is not read from; the server requires a bound of at least 90
+// seconds, and 0 sets no bound. It applies to LoadPolicy, LoadFilteredPolicy,
+// LoadPolicyStream and ExportPolicyCSV, and takes precedence over
+// WithReadPreference for them.
+func WithSecondaryLoads(maxStaleness time.Duration) Option {
+	return func(a *Adapter) error {
+		if maxStaleness == 0 {
+			a.loadReadPref = readpref.SecondaryPreferred()
+			return nil
+		}
+		if maxStaleness < 90*time.Second {
+			return errors.New("max staleness must be at least 90 seconds")
+		}
+		a.loadReadPref = readpref.SecondaryPreferred(readpref.WithMaxStaleness(maxStaleness))
+		return nil
+	}
+}
+
+// WithTenant scopes the adapter to a tenant. Every rule the adapter writes is
+// stamped with the tenant, and only that tenant's rules are loaded, saved or
+// removed, so tenants can share one collection. See Adapter.WithTenant for
+// deriving more tenant views from one connection.
+func WithTenant(id string) Option {
+	return func(a *Adapter) error {
+		a.tenant = id
+		return nil
+	}
+}
+
+// WithFilteredSave allows saving a policy that was loaded with
+// LoadFilteredPolicy. SavePolicy then replaces only the stored rules that
+// match the filter, and leaves all other rules alone. Rules added to the
+// model that do not match the filter are still saved, unless they are stored
+// already. Because the policy can be saved, IsFiltered reports false in this
+// mode once a policy has been loaded.
+func WithFilteredSave() Option {
+	return func(a *Adapter) error {
+		a.filteredSave = true
+		return nil
+	}
+}
+
+// WithTransactions runs every operation that writes several documents, such
+// as SavePolicy, AddPolicies and RemovePolicies, in a multi-document
+// transaction, so a failure never leaves the policy half-written.
+// Transactions require a replica set or a sharded cluster. A transaction is
+// limited in size and duration by the server, which bounds the size of a
+// policy that can be saved in this mode.
+func WithTransactions() Option {
+	return func(a *Adapter) error {
+		a.transactions = true
+		return nil
+	}
+}
+
+// WithTimestamps records when each rule was added and last modified, in the
+// created_at and updated_at fields of its document (see Schema to rename
+// them). SavePolicy keeps the timestamps of rules that did not change. Use
+// PoliciesChangedSince to list the rules modified after a given time.
+func WithTimestamps() Option {
+	return func(a *Adapter) error {
+		a.timestamps = true
+		return nil
+	}
+}
+
+// WithSoftDelete keeps removed rules in the collection, marked deleted by the
+// time of removal in their deleted_at field (see Schema to rename it), rather
+// than removing them. Deleted rules are never loaded; SavePolicy marks the
+// rules it replaces deleted as well. Use PurgeDeleted to remove them for
+// good.
+func WithSoftDelete() Option {
+	return func(a *Adapter) error {
+		a.softDelete = true
+		return nil
+	}
+}
+
+// WithMetadata lets rules carry metadata, such as an owner or a ticket ID,
+// see AddPolicyWithMeta. The metadata is stored in the meta field of a rule
+// (see Schema to rename it) and kept when SavePolicy rewrites the rule, which
+// then reads the stored rules first.
+func WithMetadata() Option {
+	return func(a *Adapter) error {
+		a.metadata = true
+		return nil
+	}
+}
+
+// WithExpiry lets rules expire, see AddPolicyWithTTL. The time a rule expires
+// is stored in its expires_at field (see Schema to rename it), under a TTL
+// index with which the server removes expired rules. As the server removes
+// them only about once a minute, loads skip expired rules themselves.
+func WithExpiry() Option {
+	return func(a *Adapter) error {
+		a.expiry = true
+		return nil
+	}
+}
+
+// WithActivationWindows lets rules be active only within a window of time,
+// see AddPolicyWithWindow, so access changes can be scheduled ahead. The
+// bounds are stored in the not_before and not_after fields of a rule (see
+// Schema to rename them), and loads skip rules that are not active at the
+// time. Nothing reloads the policy when a window opens or closes; see
+// NextActivationChange.
+func WithActivationWindows() Option {
+	return func(a *Adapter) error {
+		a.windows = true
+		return nil
+	}
+}
+
+// WithRuleHash stores the SHA-256 hash of each rule in its hash field (see
+// Schema to rename it), under a unique index, so that exact rule lookups such
+// as RemovePolicy and the duplicate checks of AddPolicy match a single
+// indexed field. A rule stored already is rejected with ErrDuplicateRule
+// unless DuplicatesIgnore is set. Rules stored without a hash get one when
+// the adapter connects; creating the index fails while the collection holds
+// duplicates. Every adapter writing to the collection must use WithRuleHash.
+// Hashes compare values exactly, whatever the collation.
+func WithRuleHash() Option {
+	return func(a *Adapter) error {
+		a.ruleHash = true
+		return nil
+	}
+}
+
+// WithHistory keeps a history of the policy in the named collection, or in
+// the policy collection's name with a "_history" suffix if name is empty.
+// Every write records a snapshot of the resulting policy as a new version,
+// which ListVersions lists and RestoreVersion restores. Each snapshot is a
+// single document, which limits the history to policies of about a hundred
+// thousand rules. With WithTransactions, a write and its version are
+// recorded atomically.
+func WithHistory(name string) Option {
+	return func(a *Adapter) error {
+		a.keepHistory = true
+		a.historyName = name
+		return nil
+	}
+}
+
+// WithAudit records every change of the policy in an append-only audit log,
+// the named collection, or the policy collection's name with an "_audit"
+// suffix if name is empty. Each entry holds the operation, the rules it
+// concerns, the time and the actor attached to the context with
+// ContextWithActor. RecentChanges lists the latest entries. If size is
+// positive, the log is created as a capped collection of size bytes, which
+// drops the oldest entries once it is full; an existing collection is used
+// as it is.
+func WithAudit(name string, size int64) Option {
+	return func(a *Adapter) error {
+		if size < 0 {
+			return errors.New("audit log size must not be negative")
+		}
+		a.keepAudit = true
+		a.auditName = name
+		a.auditSize = size
+		return nil
+	}
+}
+
+// WithSaveLock makes SavePolicy take the save lock for the duration of the
+// save, see AcquireSaveLock, so that of several processes sharing the policy
+// only one saves it at a time; the others fail with ErrSaveLocked. The lock
+// expires after ttl, which must exceed the time a save takes. A lock the
+// adapter acquired explicitly is kept after the save.
+func WithSaveLock(ttl time.Duration) Option {
+	return func(a *Adapter) error {
+		if ttl <= 0 {
+			return errors.New("lock duration must be positive")
+		}
+		a.saveLockTTL = ttl
+		return nil
+	}
+}
+
+// WithDryRun previews the destructive operations SavePolicy and
+// RemoveFilteredPolicy: rather than changing the stored rules, they pass the
+// rules they would add and remove to report, and succeed. Other writes, such
+// as AddPolicy, are carried out as usual. This shows the impact of deploying
+// a policy before it is saved:
+//
+//	preview, _ := mongodbadapter.NewAdapterWithError(url,
+//		mongodbadapter.WithDryRun(func(run *mongodbadapter.DryRun) {
+//			fmt.Println("added:", run.Added, "removed:", run.Removed)
+//		}))
+//	preview.SavePolicy(e.GetModel())
+func WithDryRun(report func(*DryRun)) Option {
+	return func(a *Adapter) error {
+		if report == nil {
+			return errors.New("dry run report must not be nil")
+		}
+		a.dryRunReport = report
+		return nil
+	}
+}
+
+// WithValidation checks every rule against the model m before it is stored,
+// rejecting a rule whose policy type the model does not define, or whose
+// number of values differs from its definition, with ErrInvalidRule. Only
+// the definitions of m are used, not its rules. Loading is not affected.
+func WithValidation(m model.Model) Option {
+	return func(a *Adapter) error {
+		if m == nil {
+			return errors.New("validation model must not be nil")
+		}
+		a.validation = m
+		return nil
+	}
+}
+
+// WithHooks calls the hooks around every change of the stored policy.
+// BeforeChange hooks run in the given order and AfterChange hooks in reverse,
+// like middleware. The option may be given several times.
+func WithHooks(hooks ...Hooks) Option {
+	return func(a *Adapter) error {
+		for _, h := range hooks {
+			if h == nil {
+				return errors.New("hooks must not be nil")
+			}
+		}
+		a.hooks = append(a.hooks, hooks...)
+		return nil
+	}
+}
+
+// WithEncryption encrypts the values of the given fields, "v0" to "v5" and
+// beyond, before they are stored, and decrypts them when they are read. The
+// encryption must be deterministic so that rules are still found by their
+// values; see NewAESEncryptor. Empty values are stored unencrypted.
+//
+// Filter.Raw, QueryPolicies, collations and the sort of ListPolicies see only
+// the ciphertexts of encrypted values, and Schema.NewID is called with the
+// plain values.
+func WithEncryption(enc Encryptor, fields ...string) Option {
+	return func(a *Adapter) error {
+		if enc == nil {
+			return errors.New("encryptor must not be nil")
+		}
+		if len(fields) == 0 {
+			return errors.New("no fields to encrypt")
+		}
+		encrypted := map[int]bool{}
+		for _, field := range fields {
+			i, err := strconv.Atoi(strings.TrimPrefix(field, "v"))
+			if !strings.HasPrefix(field, "v") || err != nil || i < 0 {
+				return errors.New("cannot encrypt field: " + field)
+			}
+			encrypted[i] = true
+		}
+		a.encryptor = enc
+		a.encrypted = encrypted
+		return nil
+	}
+}
+
+// WithBatchSize sets the number of rules the server returns per batch when
+// the policy is read. Larger batches need fewer round trips to load a large
+// policy; smaller ones hold less in memory. The default is chosen by the
+// server.
+func WithBatchSize(size int32) Option {
+	return func(a *Adapter) error {
+		if size <= 0 {
+			return errors.New("batch size must be positive")
+		}
+		a.batchSize = size
+		return nil
+	}
+}
+
+// WithAllowDiskUse lets the server use temporary files for reads and queries
+// of the policy that exceed its memory limits, instead of failing them.
+func WithAllowDiskUse() Option {
+	return func(a *Adapter) error {
+		a.allowDiskUse = true
+		return nil
+	}
+}
+
+// WithRetry retries operations that fail with a transient error, such as
+// while a replica set elects a new primary, up to attempts times in total.
+// The first retry waits for backoff, and each later one twice as long as the
+// one before, up to five seconds. The driver reconnects by itself and already
+// retries a failed write once; WithRetry covers longer outages. Writes are
+// only retried with WithTransactions, as a write that reached the server
+// before the error would otherwise be applied twice.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(a *Adapter) error {
+		if attempts < 1 {
+			return errors.New("retry attempts must be at least 1")
+		}
+		if backoff < 0 {
+			return errors.New("retry backoff must not be negative")
+		}
+		a.retryAttempts = attempts
+		a.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithLoadTimeout limits the time LoadPolicy, LoadFilteredPolicy and
+// LoadPolicyStream may take, including retries. It is applied on top of the
+// deadline of the context passed to the Ctx variants. A timeout of 0, the
+// default, sets no limit. It is independent of the connect timeout of the
+// constructors.
+func WithLoadTimeout(timeout time.Duration) Option {
+	return func(a *Adapter) error {
+		if timeout < 0 {
+			return errors.New("load timeout must not be negative")
+		}
+		a.loadTimeout = timeout
+		return nil
+	}
+}
+
+// WithSaveTimeout limits the time SavePolicy may take, like WithLoadTimeout.
+// It also applies to the operations replacing the whole policy:
+// ImportPolicyCSV, MigrateFrom and RestoreVersion.
+func WithSaveTimeout(timeout time.Duration) Option {
+	return func(a *Adapter) error {
+		if timeout < 0 {
+			return errors.New("save timeout must not be negative")
+		}
+		a.saveTimeout = timeout
+		return nil
+	}
+}
+
+// WithMutationTimeout limits the time the operations adding, removing and
+// updating rules may take, like WithLoadTimeout.
+func WithMutationTimeout(timeout time.Duration) Option {
+	return func(a *Adapter) error {
+		if timeout < 0 {
+			return errors.New("mutation timeout must not be negative")
+		}
+		a.mutationTimeout = timeout
+		return nil
+	}
+}
+
+// WithMetrics reports the duration and outcome of every operation, and the
+// number of rules loaded, to m.
+func WithMetrics(m Metrics) Option {
+	return func(a *Adapter) error {
+		a.metrics = m
+		return nil
+	}
+}
+
+// WithLogger makes the adapter log the queries it runs, the documents they
+// affect, retries and index creation to l, at debug level.
+func WithLogger(l Logger) Option {
+	return func(a *Adapter) error {
+		a.logger = l
+		return nil
+	}
+}
+
+// WithSlowOperationThreshold reports the operations that take longer than
+// threshold, with the shape of their query and the number of documents they
+// read or wrote, to help find missing indexes. They are logged at debug
+// level, see WithLogger, and passed to the Metrics, if it implements
+// SlowOperationObserver.
+func WithSlowOperationThreshold(threshold time.Duration) Option {
+	return func(a *Adapter) error {
+		if threshold <= 0 {
+			return errors.New("slow operation threshold must be positive")
+		}
+		a.slowThreshold = threshold
+		return nil
+	}
+}
+
+// WithTracerProvider creates the tracing spans of the adapter's operations
+// with tp instead of the global provider of OpenTelemetry.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(a *Adapter) error {
+		if tp == nil {
+			return errors.New("tracer provider must not be nil")
+		}
+		a.tracer = tp.Tracer(tracerName)
+		return nil
+	}
+}
+
+// WithCache keeps the policy read by LoadPolicy in memory for ttl, so that
+// repeated loads within ttl do not query the database. Writes through the
+// adapter invalidate the cache, and so do the changes reported to a Watcher
+// created for it. Changes by other processes are otherwise only seen once
+// ttl has passed, or after InvalidateCache. Filtered loads are not cached.
+func WithCache(ttl time.Duration) Option {
+	return func(a *Adapter) error {
+		if ttl <= 0 {
+			return errors.New("cache ttl must be positive")
+		}
+		a.cache = newPolicyCache(ttl)
+		return nil
+	}
+}
+
+// WithVerifyAfterSave reads the rules back after every SavePolicy and
+// compares them with the saved policy, rule by rule. If they differ, such as
+// after a write the cluster acknowledged but lost, SavePolicy returns
+// ErrSaveMismatch, and saving again is safe. The rules are read with the read
+// preference of the adapter, so verification needs a primary read preference
+// to be reliable. Saves of a filtered policy are not verified.
+func WithVerifyAfterSave() Option {
+	return func(a *Adapter) error {
+		a.verifySave = true
+		return nil
+	}
+}
+
+// WithIncrementalSave makes SavePolicy compare the policy with the stored
+// rules and write only the difference: stored rules the policy lacks are
+// removed and missing rules are inserted, while unchanged rules are not
+// touched at all. For a policy that rarely changes this saves most of the
+// writes, and readers never observe an empty or partial policy for the
+// rules that stay. The stored rules are read on every save, though.
+func WithIncrementalSave() Option {
+	return func(a *Adapter) error {
+		a.incrementalSave = true
+		return nil
+	}
+}
+
+// WithSnapshotFile writes the rules of every full LoadPolicy to a gzipped
+// policy file at path. If the server cannot be reached when the adapter is
+// constructed, NewAdapterWithError then succeeds as long as the file exists:
+// LoadPolicy loads the rules of the snapshot, other operations fail with
+// ErrNotConnected, and the adapter keeps trying to reach the server in the
+// background. A Watcher catches up once it is reached. Values encrypted with
+// WithEncryption stay encrypted in the snapshot.
+func WithSnapshotFile(path string) Option {
+	return func(a *Adapter) error {
+		if path == "" {
+			return errors.New("snapshot file must not be empty")
+		}
+		a.snapshotFile = path
+		return nil
+	}
+}
+
+// WithDuplicates sets how rules that are stored already are added, see
+// DuplicateMode. Both DuplicatesReject and DuplicatesIgnore rely on a unique
+// compound index over the rule fields, which they enable as if by
+// WithCompoundIndex(true). With IndexCreationDisabled, the index must be
+// created by the database administrator.
+func WithDuplicates(mode DuplicateMode) Option {
+	return func(a *Adapter) error {
+		if mode < DuplicatesAllow || mode > DuplicatesIgnore {
+			return errors.New("unknown duplicate mode")
+		}
+		a.duplicates = mode
+		if mode != DuplicatesAllow {
+			a.compoundIndex = true
+			a.uniqueIndex = true
+		}
+		return nil
+	}
+}
+
+// WithRateLimit limits the changes of the adapter, such as AddPolicy or
+// SavePolicy, to rate per second, allowing bursts of up to burst changes, so
+// that a runaway job cannot saturate a shared cluster. A change exceeding the
+// limit waits or fails with ErrThrottled, depending on mode. Views created
+// with WithTenant share the limit. Loads and queries are not limited.
+func WithRateLimit(rate float64, burst int, mode ThrottleMode) Option {
+	return func(a *Adapter) error {
+		if rate <= 0 || burst <= 0 {
+			return errors.New("rate limit and burst must be positive")
+		}
+		if mode != ThrottleWait && mode != ThrottleReject {
+			return errors.New("unknown throttle mode")
+		}
+		a.limiter = newRateLimiter(rate, burst, mode)
+		return nil
+	}
+}
+
+// WithCircuitBreaker fails operations with ErrCircuitOpen, without waiting
+// for the server, once failures operations in a row could not reach it or
+// timed out. After cooldown, a single operation is let through to probe the
+// server; if it gets an answer, operations resume. Operations that need no
+// server, such as loads served by the cache, still succeed while the circuit
+// is open. Views created with WithTenant share the circuit.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(a *Adapter) error {
+		if failures <= 0 || cooldown <= 0 {
+			return errors.New("circuit breaker failures and cooldown must be positive")
+		}
+		a.breaker = newCircuitBreaker(failures, cooldown)
+		return nil
+	}
+}
+
+// WithInsertBatchSize splits the rules written by SavePolicy and AddPolicies
+// into chunks of at most size rules, each inserted with its own command. The
+// driver already splits commands that exceed the server's limits; smaller
+// chunks bound the memory of each command and allow inserting them in
+// parallel, see WithInsertConcurrency.
+func WithInsertBatchSize(size int) Option {
+	return func(a *Adapter) error {
+		if size <= 0 {
+			return errors.New("insert batch size must be positive")
+		}
+		a.insertBatch = size
+		return nil
+	}
+}
+
+// WithInsertConcurrency inserts up to n chunks of rules at once, see
+// WithInsertBatchSize. Inside a transaction, chunks are always inserted one
+// after the other.
+func WithInsertConcurrency(n int) Option {
+	return func(a *Adapter) error {
+		if n <= 0 {
+			return errors.New("insert concurrency must be positive")
+		}
+		a.insertWorkers = n
+		return nil
+	}
+}
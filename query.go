@@ -0,0 +1,309 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// QueryPolicies runs an aggregation pipeline over the stored rules and
+// returns the resulting documents as rules, without loading the policy into
+// a model. Result documents are read like stored rules: the values of the
+// fields "v0" to "v5", up to the first empty one, make up a rule. For
+// example, the subjects that may write to data1:
+//
+//	a.QueryPolicies(mongo.Pipeline{
+//		{{Key: "$match", Value: bson.M{"ptype": "p", "v1": "data1", "v2": "write"}}},
+//		{{Key: "$group", Value: bson.M{"_id": "$v0"}}},
+//		{{Key: "$project", Value: bson.M{"v0": "$_id"}}},
+//	})
+func (a *Adapter) QueryPolicies(pipeline mongo.Pipeline) ([][]string, error) {
+	return a.QueryPoliciesCtx(context.Background(), pipeline)
+}
+
+// QueryPoliciesCtx is like QueryPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) QueryPoliciesCtx(ctx context.Context, pipeline mongo.Pipeline) (rules [][]string, err error) {
+	ctx, end := a.begin(ctx, "QueryPolicies")
+	defer func() { err = end(err) }()
+
+	if a.tenant != "" || a.softDelete {
+		// Never let a tenant see the rules of others, nor anyone deleted rules.
+		scoped := mongo.Pipeline{{{Key: "$match", Value: a.scope(bson.M{})}}}
+		pipeline = append(scoped, pipeline...)
+	}
+
+	opts := options.Aggregate()
+	if a.batchSize > 0 {
+		opts.SetBatchSize(a.batchSize)
+	}
+	if a.allowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
+	}
+
+	cursor, err := a.collection.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules = [][]string{}
+	for cursor.Next(ctx) {
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, line.toStringPolicy())
+	}
+
+	return rules, cursor.Err()
+}
+
+// TimestampedRule is a stored rule along with the times it was added and last
+// modified, see WithTimestamps.
+type TimestampedRule struct {
+	PType     string
+	Rule      []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PoliciesChangedSince returns the rules added or modified at or after since,
+// oldest change first. It requires WithTimestamps. Removed rules are not
+// reported.
+func (a *Adapter) PoliciesChangedSince(since time.Time) ([]TimestampedRule, error) {
+	return a.PoliciesChangedSinceCtx(context.Background(), since)
+}
+
+// PoliciesChangedSinceCtx is like PoliciesChangedSince but honors the deadline and cancellation of ctx.
+func (a *Adapter) PoliciesChangedSinceCtx(ctx context.Context, since time.Time) (changed []TimestampedRule, err error) {
+	ctx, end := a.begin(ctx, "PoliciesChangedSince")
+	defer func() { err = end(err) }()
+
+	if !a.timestamps {
+		return nil, errors.New("timestamps are not enabled")
+	}
+
+	selector := a.scope(bson.M{a.schema.UpdatedAt: bson.M{"$gte": since}})
+	opts := options.Find().SetSort(bson.D{{Key: a.schema.UpdatedAt, Value: 1}})
+
+	cursor, err := a.collection.Find(ctx, selector, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changed = []TimestampedRule{}
+	for cursor.Next(ctx) {
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		created, _ := cursor.Current.Lookup(a.schema.CreatedAt).TimeOK()
+		updated, _ := cursor.Current.Lookup(a.schema.UpdatedAt).TimeOK()
+		changed = append(changed, TimestampedRule{
+			PType:     line.PType,
+			Rule:      line.toStringPolicy(),
+			CreatedAt: created,
+			UpdatedAt: updated,
+		})
+	}
+
+	return changed, cursor.Err()
+}
+
+// PolicyPage is a page of stored rules, see ListPolicies.
+type PolicyPage struct {
+	// Rules are the rules of the page, each given as its ptype followed by
+	// its values.
+	Rules [][]string
+	// Total is the number of rules matching the filter on all pages.
+	Total int64
+	// Meta holds the metadata of the rules, see WithMetadata, in the order
+	// of Rules. It is nil unless metadata is enabled, and holds nil for rules
+	// without metadata.
+	Meta []map[string]string
+}
+
+// ListPolicies returns a page of the stored rules matching filter, or of all
+// rules if filter is nil, for example for an administration UI. It skips the
+// first skip rules and returns at most limit rules; a limit of 0 returns all
+// remaining rules. The rules are sorted by the fields in sort, "ptype" or "v0"
+// to "v5", each descending if prefixed with "-", and otherwise in the order
+// they were stored. Filter.Raw selectors use the stored field names.
+func (a *Adapter) ListPolicies(filter *Filter, skip, limit int64, sort ...string) (*PolicyPage, error) {
+	return a.ListPoliciesCtx(context.Background(), filter, skip, limit, sort...)
+}
+
+// ListPoliciesCtx is like ListPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) ListPoliciesCtx(ctx context.Context, filter *Filter, skip, limit int64, sort ...string) (page *PolicyPage, err error) {
+	ctx, end := a.begin(ctx, "ListPolicies")
+	defer func() { err = end(err) }()
+
+	if skip < 0 || limit < 0 {
+		return nil, errors.New("skip and limit must not be negative")
+	}
+
+	order := make(bson.D, 0, len(sort)+1)
+	for _, field := range sort {
+		dir := 1
+		if strings.HasPrefix(field, "-") {
+			field, dir = field[1:], -1
+		}
+		if !isRuleField(field) {
+			return nil, errors.New("unknown rule field: " + field)
+		}
+		order = append(order, bson.E{Key: a.schema.field(field), Value: dir})
+	}
+	// Pages must not overlap, so the order has to be total.
+	order = append(order, bson.E{Key: "_id", Value: 1})
+
+	var selector interface{} = a.scope(bson.M{})
+	if filter != nil {
+		selector = a.scope(filter.selector(a))
+	}
+	selector = a.active(selector)
+
+	countOpts := options.Count()
+	if a.collation != nil {
+		countOpts.SetCollation(a.collation)
+	}
+	total, err := a.collection.CountDocuments(ctx, selector, countOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := a.findOptions().SetSort(order).SetSkip(skip)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := a.collection.Find(ctx, selector, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	page = &PolicyPage{Rules: [][]string{}, Total: total}
+	for cursor.Next(ctx) {
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		page.Rules = append(page.Rules, append([]string{line.PType}, line.toStringPolicy()...))
+		if a.metadata {
+			page.Meta = append(page.Meta, a.decodeMeta(cursor.Current))
+		}
+	}
+
+	return page, cursor.Err()
+}
+
+// HasPolicy reports whether the rule is stored, without loading the policy.
+// The rule is looked up like RemovePolicy looks it up, using the compound
+// index or the rule hash if there is one, see WithCompoundIndex and
+// WithRuleHash.
+func (a *Adapter) HasPolicy(sec string, ptype string, rule []string) (bool, error) {
+	return a.HasPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// HasPolicyCtx is like HasPolicy but honors the deadline and cancellation of ctx.
+func (a *Adapter) HasPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) (found bool, err error) {
+	ctx, end := a.begin(ctx, "HasPolicy")
+	defer func() { err = end(err) }()
+
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
+	}
+	err = a.collection.FindOne(ctx, a.active(a.selector(a.ruleLine(ptype, rule))), opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetPolicies returns the stored rules of the policy type that match the
+// filter, like the model's GetFilteredPolicy but filtered by the server and
+// without loading the policy. Empty field values act as wildcards, as for
+// RemoveFilteredPolicy.
+func (a *Adapter) GetPolicies(ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.GetPoliciesCtx(context.Background(), ptype, fieldIndex, fieldValues...)
+}
+
+// GetPoliciesCtx is like GetPolicies but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetPoliciesCtx(ctx context.Context, ptype string, fieldIndex int, fieldValues ...string) (rules [][]string, err error) {
+	ctx, end := a.begin(ctx, "GetPolicies")
+	defer func() { err = end(err) }()
+
+	return a.findRules(ctx, a.filteredSelector(ptype, fieldIndex, fieldValues...))
+}
+
+// GetPoliciesForObjectPrefix returns the stored "p" rules whose object, v1,
+// starts with prefix, such as all rules governing the resources under
+// "/projects/42/". A trailing "*" of prefix is ignored, so "/projects/42/*"
+// is the same prefix. The rules are matched by an anchored regular
+// expression, which the server answers from the index of v1, unless the
+// adapter uses a collation, see WithCollation. Prefixes cannot be matched
+// against encrypted objects.
+func (a *Adapter) GetPoliciesForObjectPrefix(prefix string) ([][]string, error) {
+	return a.GetPoliciesForObjectPrefixCtx(context.Background(), prefix)
+}
+
+// GetPoliciesForObjectPrefixCtx is like GetPoliciesForObjectPrefix but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetPoliciesForObjectPrefixCtx(ctx context.Context, prefix string) (rules [][]string, err error) {
+	ctx, end := a.begin(ctx, "GetPoliciesForObjectPrefix")
+	defer func() { err = end(err) }()
+
+	if a.encrypted[1] {
+		return nil, errors.New("cannot match a prefix of encrypted objects")
+	}
+
+	prefix = a.normalize(1, strings.TrimSuffix(prefix, "*"))
+	selector := a.filteredSelector("p", 0)
+	selector[a.schema.value(1)] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}
+	return a.findRules(ctx, selector)
+}
+
+// findRules returns the active stored rules of the adapter matching the
+// selector.
+func (a *Adapter) findRules(ctx context.Context, selector bson.M) ([][]string, error) {
+	cursor, err := a.collection.Find(ctx, a.active(a.scope(selector)), a.findOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rules := [][]string{}
+	for cursor.Next(ctx) {
+		line, err := a.decodeLine(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, line.toStringPolicy())
+	}
+
+	return rules, cursor.Err()
+}
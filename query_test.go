@@ -0,0 +1,195 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestQueryPolicies(t *testing.T) {
+	initPolicy(t)
+
+	a := NewAdapter(getDbURL()).(*Adapter)
+	defer a.dropTable(context.Background())
+
+	// Which subjects can access data2?
+	subjects, err := a.QueryPolicies(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ptype": "p", "v1": "data2"}}},
+		{{Key: "$group", Value: bson.M{"_id": "$v0"}}},
+		{{Key: "$project", Value: bson.M{"v0": "$_id"}}},
+		{{Key: "$sort", Value: bson.M{"v0": 1}}},
+	})
+	if err != nil {
+		t.Errorf("Expected QueryPolicies() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(subjects, [][]string{{"bob"}, {"data2_admin"}}) {
+		t.Errorf("Unexpected query result: %v", subjects)
+	}
+
+	// Rule documents are returned as rules.
+	rules, err := a.QueryPolicies(mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ptype": "g"}}},
+	})
+	if err != nil {
+		t.Errorf("Expected QueryPolicies() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(rules, [][]string{{"alice", "data2_admin"}}) {
+		t.Errorf("Unexpected query result: %v", rules)
+	}
+}
+
+func TestPoliciesChangedSince(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_timestamps", WithTimestamps())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.AddPolicy("alice", "data1", "read")
+	e.AddPolicy("bob", "data2", "write")
+
+	// BSON stores milliseconds.
+	time.Sleep(10 * time.Millisecond)
+	since := time.Now()
+
+	if err := a.UpdatePolicy("p", "p", []string{"bob", "data2", "write"}, []string{"bob", "data2", "read"}); err != nil {
+		t.Errorf("Expected UpdatePolicy() to be successful; got %v", err)
+	}
+	// Saving keeps the timestamps of unchanged rules.
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	if err := e.SavePolicy(); err != nil {
+		t.Errorf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	rules, err := a.PoliciesChangedSince(since)
+	if err != nil {
+		t.Fatalf("Expected PoliciesChangedSince() to be successful; got %v", err)
+	}
+	if len(rules) != 1 || !util.ArrayEquals(rules[0].Rule, []string{"bob", "data2", "read"}) {
+		t.Fatalf("Unexpected changed rules: %v", rules)
+	}
+	if !rules[0].CreatedAt.Before(since) || rules[0].UpdatedAt.Before(since) {
+		t.Errorf("Unexpected timestamps: created %v, updated %v", rules[0].CreatedAt, rules[0].UpdatedAt)
+	}
+
+	if _, err := NewAdapter(getDbURL()).(*Adapter).PoliciesChangedSince(since); err == nil {
+		t.Errorf("Expected PoliciesChangedSince() to fail without timestamps")
+	}
+}
+
+func TestListPolicies(t *testing.T) {
+	initPolicy(t)
+
+	a := NewAdapter(getDbURL()).(*Adapter)
+	page, err := a.ListPolicies(&Filter{PType: []string{"p"}}, 1, 2, "v0", "-v2")
+	if err != nil {
+		t.Fatalf("Expected ListPolicies() to be successful; got %v", err)
+	}
+	want := [][]string{{"p", "bob", "data2", "write"}, {"p", "data2_admin", "data2", "write"}}
+	if page.Total != 4 || !util.Array2DEquals(page.Rules, want) {
+		t.Errorf("Expected %v of 4 rules; got %v of %d", want, page.Rules, page.Total)
+	}
+
+	if page, err := a.ListPolicies(nil, 0, 0); err != nil || page.Total != 5 || len(page.Rules) != 5 {
+		t.Errorf("Expected all 5 rules; got %+v, %v", page, err)
+	}
+	if _, err := a.ListPolicies(nil, 0, 10, "owner"); err == nil {
+		t.Errorf("Expected ListPolicies() to reject an unknown sort field")
+	}
+}
+
+func TestHasPolicy(t *testing.T) {
+	initPolicy(t)
+
+	a := NewAdapter(getDbURL()).(*Adapter)
+	defer a.dropTable(context.Background())
+
+	found, err := a.HasPolicy("p", "p", []string{"alice", "data1", "read"})
+	if err != nil || !found {
+		t.Errorf("Expected HasPolicy() to find the rule; got %v, %v", found, err)
+	}
+	found, err = a.HasPolicy("p", "p", []string{"alice", "data1"})
+	if err != nil || found {
+		t.Errorf("Expected HasPolicy() not to find a partial rule; got %v, %v", found, err)
+	}
+	found, err = a.HasPolicy("g", "g", []string{"alice", "data1", "read"})
+	if err != nil || found {
+		t.Errorf("Expected HasPolicy() not to find a rule of another type; got %v, %v", found, err)
+	}
+}
+
+func TestGetPolicies(t *testing.T) {
+	initPolicy(t)
+
+	a := NewAdapter(getDbURL()).(*Adapter)
+	defer a.dropTable(context.Background())
+
+	rules, err := a.GetPolicies("p", 1, "data2")
+	if err != nil {
+		t.Errorf("Expected GetPolicies() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(rules, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}) {
+		t.Errorf("Unexpected rules: %v", rules)
+	}
+
+	rules, err = a.GetPolicies("p", 0, "data2_admin", "", "read")
+	if err != nil {
+		t.Errorf("Expected GetPolicies() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(rules, [][]string{{"data2_admin", "data2", "read"}}) {
+		t.Errorf("Unexpected rules: %v", rules)
+	}
+
+	rules, err = a.GetPolicies("g", 0, "bob")
+	if err != nil || len(rules) != 0 {
+		t.Errorf("Expected GetPolicies() to return no rules; got %v, %v", rules, err)
+	}
+}
+
+func TestGetPoliciesForObjectPrefix(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_prefix")
+
+	err := a.AddPolicies("p", "p", [][]string{
+		{"alice", "/projects/42/docs", "read"},
+		{"bob", "/projects/42", "write"},
+		{"carol", "/projects/420/docs", "read"},
+		{"dave", "/projects/4.2/docs", "read"},
+	})
+	if err != nil {
+		t.Fatalf("Expected AddPolicies() to be successful; got %v", err)
+	}
+
+	rules, err := a.GetPoliciesForObjectPrefix("/projects/42/*")
+	if err != nil {
+		t.Fatalf("Expected GetPoliciesForObjectPrefix() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(rules, [][]string{{"alice", "/projects/42/docs", "read"}}) {
+		t.Errorf("Unexpected rules: %v", rules)
+	}
+
+	// The prefix is matched literally.
+	rules, err = a.GetPoliciesForObjectPrefix("/projects/4.")
+	if err != nil {
+		t.Fatalf("Expected GetPoliciesForObjectPrefix() to be successful; got %v", err)
+	}
+	if !util.Array2DEquals(rules, [][]string{{"dave", "/projects/4.2/docs", "read"}}) {
+		t.Errorf("Unexpected rules: %v", rules)
+	}
+}
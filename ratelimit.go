@@ -0,0 +1,105 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ThrottleMode controls what a change does when it exceeds the rate limit,
+// see WithRateLimit.
+type ThrottleMode int
+
+const (
+	// ThrottleWait blocks the change until the rate limit allows it, or its
+	// context is done.
+	ThrottleWait ThrottleMode = iota
+	// ThrottleReject fails the change with ErrThrottled.
+	ThrottleReject
+)
+
+// rateLimiter is a token bucket shared by all changes of an adapter and its
+// views.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	mode  ThrottleMode
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int, mode ThrottleMode) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		mode:   mode,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns the time to wait until it is due. In
+// ThrottleReject mode, it takes no token and fails if none is left.
+func (l *rateLimiter) reserve() (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, nil
+	}
+	if l.mode == ThrottleReject {
+		return 0, ErrThrottled
+	}
+	// The token is taken ahead of time, so waiting changes queue up.
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	l.tokens--
+	return delay, nil
+}
+
+// release returns a token taken by a change that gave up waiting.
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = math.Min(l.burst, l.tokens+1)
+}
+
+// wait blocks until the rate limit allows another change.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	delay, err := l.reserve()
+	if err != nil || delay == 0 {
+		return err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.release()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdapterWithRateLimit(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_rate_limit", WithRateLimit(0.1, 2, ThrottleReject))
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"bob", "data2", "write"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrThrottled) {
+		t.Errorf("Expected AddPolicy() to fail with ErrThrottled; got %v", err)
+	}
+
+	// Loads are not limited.
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	waiting := newTestAdapter(t, "casbin_rule_rate_limit", WithRateLimit(20, 1, ThrottleWait))
+	defer waiting.Close()
+
+	start := time.Now()
+	for _, rule := range [][]string{{"carol", "data3", "read"}, {"dave", "data4", "read"}, {"erin", "data5", "read"}} {
+		if err := waiting.AddPolicy("p", "p", rule); err != nil {
+			t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected AddPolicy() to wait for the rate limit; took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waiting.AddPolicyCtx(ctx, "p", "p", []string{"frank", "data6", "read"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected AddPolicyCtx() to give up waiting; got %v", err)
+	}
+
+	if _, err := NewAdapterWithError(getDbURL(), WithRateLimit(0, 1, ThrottleWait)); err == nil {
+		t.Error("Expected NewAdapterWithError() to reject a rate of 0")
+	}
+}
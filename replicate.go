@@ -0,0 +1,100 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Replicate copies the stored rules matching filter, or all rules if filter
+// is nil, to target, which may use another cluster, database or collection,
+// such as when promoting a policy from staging to production or keeping a
+// standby cluster for disaster recovery. The rules of target matching filter
+// are replaced. Rules are read and decoded with the options of a, and written
+// in batches with the options of target, so both may use different schemas
+// or encryption keys. If progress is not nil, it is called after each batch
+// of rules is written, with the number of rules written so far and the
+// total. With WithTransactions on target, its rules are replaced atomically.
+func (a *Adapter) Replicate(target *Adapter, filter *Filter, progress func(written, total int)) error {
+	return a.ReplicateCtx(context.Background(), target, filter, progress)
+}
+
+// ReplicateCtx is like Replicate but honors the deadline and cancellation of ctx.
+func (a *Adapter) ReplicateCtx(ctx context.Context, target *Adapter, filter *Filter, progress func(written, total int)) (err error) {
+	ctx, end := a.begin(ctx, "Replicate")
+	defer func() { err = end(err) }()
+
+	if target == nil || target == a {
+		return errors.New("target adapter must not be nil or the source adapter")
+	}
+
+	source, dest := a.scope(bson.M{}), target.scope(bson.M{})
+	if filter != nil {
+		source, dest = a.scope(filter.selector(a)), target.scope(filter.selector(target))
+	}
+
+	total, err := a.loads.CountDocuments(ctx, a.active(source))
+	if err != nil {
+		return err
+	}
+	batch := target.progressBatch()
+
+	// The rules are read with ctx rather than the context of the write, which
+	// may carry a session of the client of target.
+	return target.withHistory(ctx, change{op: "import"}, func(wctx context.Context) error {
+		if err := target.deleteMany(wctx, dest); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(0, int(total))
+		}
+
+		written := 0
+		docs := make([]interface{}, 0, batch)
+		flush := func() error {
+			if len(docs) == 0 {
+				return nil
+			}
+			if err := target.insertMany(wctx, target.collection, docs); err != nil {
+				return err
+			}
+			written += len(docs)
+			docs = docs[:0]
+			if progress != nil {
+				progress(written, int(total))
+			}
+			return nil
+		}
+
+		_, err := a.forEachLine(ctx, a.loads, source, func(line CasbinRule) error {
+			rule := line.toStringPolicy()
+			if err := target.validateRule(line.PType, rule); err != nil {
+				return err
+			}
+			docs = append(docs, target.document(target.ruleLine(line.PType, rule)))
+			if len(docs) < batch {
+				return nil
+			}
+			return flush()
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+}
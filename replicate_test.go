@@ -0,0 +1,63 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestAdapterReplicate(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_staging")
+
+	target := newTestAdapter(t, "casbin_rule_production", WithInsertBatchSize(2))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	if err := target.AddPolicy("p", "p", []string{"mallory", "data1", "write"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := target.AddPolicy("g", "g", []string{"mallory", "data2_admin"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	// Only the policy rules are replaced; the role assignments of the target
+	// are kept.
+	var reports [][2]int
+	err := a.Replicate(target, &Filter{PType: []string{"p"}}, func(written, total int) {
+		reports = append(reports, [2]int{written, total})
+	})
+	if err != nil {
+		t.Fatalf("Expected Replicate() to be successful; got %v", err)
+	}
+	if len(reports) != 3 || reports[2] != [2]int{4, 4} {
+		t.Errorf("Expected progress after each batch of 2 rules; got %v", reports)
+	}
+
+	te := newEnforcer(t, "examples/rbac_model.conf", target)
+	testGetPolicy(t, te, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	if found, _ := te.HasGroupingPolicy("mallory", "data2_admin"); !found {
+		t.Errorf("Expected the role assignment of the target to be kept")
+	}
+	if found, _ := te.HasGroupingPolicy("alice", "data2_admin"); found {
+		t.Errorf("Expected the role assignment of the source not to be copied")
+	}
+
+	if err := a.Replicate(a, nil, nil); err == nil {
+		t.Errorf("Expected Replicate() to fail for the source adapter as target")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRetryBackoff caps the delay between two attempts of an operation.
+const maxRetryBackoff = 5 * time.Second
+
+// transientCodes are the server error codes reported while a replica set
+// elects a new primary or a server shuts down.
+var transientCodes = []int{
+	6,     // HostUnreachable
+	7,     // HostNotFound
+	89,    // NetworkTimeout
+	91,    // ShutdownInProgress
+	189,   // PrimarySteppedDown
+	262,   // ExceededTimeLimit
+	9001,  // SocketException
+	10107, // NotWritablePrimary
+	11600, // InterruptedAtShutdown
+	11602, // InterruptedDueToReplStateChange
+	13435, // NotPrimaryNoSecondaryOk
+	13436, // NotPrimaryOrSecondary
+}
+
+// isTransient reports whether err may go away when the operation is retried,
+// such as while a replica set fails over.
+func isTransient(err error) bool {
+	if mongo.IsNetworkError(err) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return false
+	}
+	if serverErr.HasErrorLabel("RetryableWriteError") || serverErr.HasErrorLabel("TransientTransactionError") {
+		return true
+	}
+	for _, code := range transientCodes {
+		if serverErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry runs fn, and runs it again after transient errors as configured by
+// WithRetry, waiting twice as long before each attempt. Inside a transaction
+// fn runs once; the transaction as a whole is retried instead.
+func (a *Adapter) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	return a.retryErrors(ctx, true, fn)
+}
+
+// retryThrottled is like retry, but only runs fn again after Cosmos DB
+// throttled it, see WithCosmosDB.
+func (a *Adapter) retryThrottled(ctx context.Context, fn func(ctx context.Context) error) error {
+	return a.retryErrors(ctx, false, fn)
+}
+
+// retryErrors implements retry, retrying transient errors only if transient
+// is set.
+func (a *Adapter) retryErrors(ctx context.Context, transient bool, fn func(ctx context.Context) error) error {
+	attempts, backoff := a.retryAttempts, a.retryBackoff
+	if a.compat == compatCosmosDB && attempts <= 1 {
+		attempts, backoff = cosmosRetryAttempts, cosmosRetryBackoff
+	}
+	if attempts <= 1 || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		delay := backoff
+		switch {
+		case a.compat == compatCosmosDB && isThrottled(err):
+			// Cosmos DB tells how long to wait for the throughput to recover.
+			if after, ok := retryAfter(err); ok {
+				delay = after
+			}
+		case !transient || !isTransient(err) || a.retryAttempts <= 1:
+			// Without WithRetry only throttled requests are retried.
+			return err
+		}
+
+		a.debug("retrying after transient error", "attempt", attempt, "backoff", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsTransient(t *testing.T) {
+	if !isTransient(mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}) {
+		t.Error("Expected a stepped down primary to be transient")
+	}
+	if isTransient(mongo.CommandError{Code: 13, Name: "Unauthorized"}) {
+		t.Error("Expected an authorization failure not to be transient")
+	}
+	if isTransient(errors.New("boom")) {
+		t.Error("Expected a plain error not to be transient")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	a, err := newAdapter([]Option{WithRetry(3, time.Millisecond)})
+	if err != nil {
+		t.Fatalf("Expected newAdapter() to be successful; got %v", err)
+	}
+
+	calls := 0
+	err = a.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Expected 3 failed attempts; got %d, %v", calls, err)
+	}
+
+	calls = 0
+	err = a.retry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return errors.New("boom")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a permanent error not to be retried; got %d attempts", calls)
+	}
+
+	// Writes outside of transactions are not retried.
+	calls = 0
+	err = a.withHistory(context.Background(), change{op: "add"}, func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a write not to be retried; got %d attempts", calls)
+	}
+
+	if _, err := newAdapter([]Option{WithRetry(0, time.Second)}); err == nil {
+		t.Error("Expected WithRetry() to reject 0 attempts")
+	}
+}
+
+func TestRetryThrottledWrite(t *testing.T) {
+	a, err := newAdapter([]Option{WithCosmosDB()})
+	if err != nil {
+		t.Fatalf("Expected newAdapter() to be successful; got %v", err)
+	}
+
+	// A throttled single write runs again outside of transactions.
+	calls := 0
+	err = a.withHistory(context.Background(), change{op: "add", rejectable: true}, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return mongo.CommandError{Code: 16500, Message: "Request rate is large. RetryAfterMs=1"}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected a throttled write to be retried; got %d attempts, %v", calls, err)
+	}
+
+	// Other writes may have been applied in part, so they run once.
+	calls = 0
+	err = a.withHistory(context.Background(), change{op: "add"}, func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 16500, Message: "Request rate is large. RetryAfterMs=1"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a write of several documents not to be retried; got %d attempts", calls)
+	}
+
+	// Transient errors of single writes are left to the driver.
+	calls = 0
+	err = a.withHistory(context.Background(), change{op: "add", rejectable: true}, func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected a transient error not to be retried; got %d attempts", calls)
+	}
+}
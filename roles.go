@@ -0,0 +1,204 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetRolesForUser returns the roles the stored "g" rules assign to user
+// directly, like the enforcer's GetRolesForUser but looked up by the server
+// through the index of v0, without loading the policy. If a domain is given,
+// only the roles assigned in that domain are returned. Roles inherited
+// through other roles are not included.
+func (a *Adapter) GetRolesForUser(user string, domain ...string) ([]string, error) {
+	return a.GetRolesForUserCtx(context.Background(), user, domain...)
+}
+
+// GetRolesForUserCtx is like GetRolesForUser but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetRolesForUserCtx(ctx context.Context, user string, domain ...string) (roles []string, err error) {
+	ctx, end := a.begin(ctx, "GetRolesForUser")
+	defer func() { err = end(err) }()
+
+	if user == "" {
+		return nil, errors.New("user must not be empty")
+	}
+	rules, err := a.findRules(ctx, a.filteredSelector("g", 0, append([]string{user, ""}, domain...)...))
+	if err != nil {
+		return nil, err
+	}
+	return ruleValues(rules, 1), nil
+}
+
+// GetImplicitRolesForUser returns the roles the stored "g" rules assign to
+// user, directly or through other roles, like the enforcer's
+// GetImplicitRolesForUser. The role graph is walked by the server with
+// $graphLookup, so a large graph is never transferred. maxDepth limits the
+// number of role levels followed, 1 returning only the direct roles; 0 follows
+// the graph to its end. If a domain is given, only the assignments in that
+// domain are followed. Direct roles come first, followed by the inherited ones
+// in the order of their distance from user. The lookup needs the value fields
+// of the default layout, and v0 and v1 must either both be encrypted or not at
+// all.
+func (a *Adapter) GetImplicitRolesForUser(user string, maxDepth int, domain ...string) ([]string, error) {
+	return a.GetImplicitRolesForUserCtx(context.Background(), user, maxDepth, domain...)
+}
+
+// GetImplicitRolesForUserCtx is like GetImplicitRolesForUser but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetImplicitRolesForUserCtx(ctx context.Context, user string, maxDepth int, domain ...string) (roles []string, err error) {
+	ctx, end := a.begin(ctx, "GetImplicitRolesForUser")
+	defer func() { err = end(err) }()
+
+	if user == "" {
+		return nil, errors.New("user must not be empty")
+	}
+	if maxDepth < 0 {
+		return nil, errors.New("maximum depth must not be negative")
+	}
+	if a.schema.Array != "" || a.serializer != nil {
+		return nil, errors.New("implicit roles need the value fields of the default layout")
+	}
+	if a.encrypted[0] != a.encrypted[1] {
+		return nil, errors.New("implicit roles need v0 and v1 to be encrypted alike")
+	}
+
+	subject, role := a.schema.value(0), a.schema.value(1)
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: a.active(a.scope(a.filteredSelector("g", 0, append([]string{user, ""}, domain...)...)))}},
+	}
+	if maxDepth != 1 {
+		lookup := bson.M{
+			"from":                    a.collection.Name(),
+			"startWith":               "$" + role,
+			"connectFromField":        role,
+			"connectToField":          subject,
+			"as":                      "inherited",
+			"depthField":              "depth",
+			"restrictSearchWithMatch": a.active(a.scope(a.filteredSelector("g", 2, domain...))),
+		}
+		if maxDepth > 1 {
+			// The lookup starts from the direct roles, one level down.
+			lookup["maxDepth"] = maxDepth - 2
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$graphLookup", Value: lookup}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.M{
+		"_id":  0,
+		"role": "$" + role,
+		"inherited": bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$inherited", bson.A{}}},
+			"in":    bson.M{"role": "$$this." + role, "depth": "$$this.depth"},
+		}},
+	}}})
+
+	opts := options.Aggregate()
+	if a.allowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if a.collation != nil {
+		opts.SetCollation(a.collation)
+	}
+	cursor, err := a.collection.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	type inheritedRole struct {
+		Role  string `bson:"role"`
+		Depth int64  `bson:"depth"`
+	}
+	var direct []string
+	var inherited []inheritedRole
+	for cursor.Next(ctx) {
+		var doc struct {
+			Role      string          `bson:"role"`
+			Inherited []inheritedRole `bson:"inherited"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		direct = append(direct, doc.Role)
+		inherited = append(inherited, doc.Inherited...)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(inherited, func(i, j int) bool { return inherited[i].Depth < inherited[j].Depth })
+	for _, r := range inherited {
+		direct = append(direct, r.Role)
+	}
+	roles = []string{}
+	seen := map[string]bool{}
+	for _, r := range direct {
+		if a.encrypted[1] {
+			plain, err := a.encryptor.Decrypt(r)
+			if err != nil {
+				return nil, &wrappedError{sentinel: ErrDecrypt, err: err}
+			}
+			r = plain
+		}
+		if !seen[r] && r != user {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	return roles, nil
+}
+
+// GetUsersForRole returns the users the stored "g" rules assign role to
+// directly, like the enforcer's GetUsersForRole but looked up by the server
+// through the index of v1, without loading the policy. If a domain is given,
+// only the users assigned the role in that domain are returned.
+func (a *Adapter) GetUsersForRole(role string, domain ...string) ([]string, error) {
+	return a.GetUsersForRoleCtx(context.Background(), role, domain...)
+}
+
+// GetUsersForRoleCtx is like GetUsersForRole but honors the deadline and cancellation of ctx.
+func (a *Adapter) GetUsersForRoleCtx(ctx context.Context, role string, domain ...string) (users []string, err error) {
+	ctx, end := a.begin(ctx, "GetUsersForRole")
+	defer func() { err = end(err) }()
+
+	if role == "" {
+		return nil, errors.New("role must not be empty")
+	}
+	rules, err := a.findRules(ctx, a.filteredSelector("g", 1, append([]string{role}, domain...)...))
+	if err != nil {
+		return nil, err
+	}
+	return ruleValues(rules, 0), nil
+}
+
+// ruleValues returns the distinct values of the rules at index, in the order
+// of the rules.
+func ruleValues(rules [][]string, index int) []string {
+	seen := map[string]bool{}
+	values := []string{}
+	for _, rule := range rules {
+		if index >= len(rule) || seen[rule[index]] {
+			continue
+		}
+		seen[rule[index]] = true
+		values = append(values, rule[index])
+	}
+	return values
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdapterRoleQueries(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_roles")
+
+	err := a.AddPolicies("g", "g", [][]string{
+		{"alice", "data2_admin"},
+		{"alice", "auditor"},
+		{"bob", "data2_admin"},
+		{"carol", "data2_admin", "tenant1"},
+		{"data2_admin", "staff"},
+	})
+	if err != nil {
+		t.Fatalf("Expected AddPolicies() to be successful; got %v", err)
+	}
+
+	roles, err := a.GetRolesForUser("alice")
+	if err != nil {
+		t.Fatalf("Expected GetRolesForUser() to be successful; got %v", err)
+	}
+	if want := []string{"data2_admin", "auditor"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("Expected roles %v; got %v", want, roles)
+	}
+
+	users, err := a.GetUsersForRole("data2_admin")
+	if err != nil {
+		t.Fatalf("Expected GetUsersForRole() to be successful; got %v", err)
+	}
+	if want := []string{"alice", "bob", "carol"}; !reflect.DeepEqual(users, want) {
+		t.Errorf("Expected users %v; got %v", want, users)
+	}
+	if users, _ := a.GetUsersForRole("data2_admin", "tenant1"); !reflect.DeepEqual(users, []string{"carol"}) {
+		t.Errorf("Expected the users of the domain to be [carol]; got %v", users)
+	}
+
+	if _, err := a.GetRolesForUser(""); err == nil {
+		t.Errorf("Expected GetRolesForUser() to fail for an empty user")
+	}
+}
+
+func TestAdapterGetImplicitRolesForUser(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_implicit_roles")
+
+	err := a.AddPolicies("g", "g", [][]string{
+		{"alice", "data2_admin"},
+		{"data2_admin", "staff"},
+		{"staff", "employee"},
+		{"employee", "staff"},
+		{"alice", "auditor"},
+		{"bob", "staff"},
+	})
+	if err != nil {
+		t.Fatalf("Expected AddPolicies() to be successful; got %v", err)
+	}
+
+	roles, err := a.GetImplicitRolesForUser("alice", 0)
+	if err != nil {
+		t.Fatalf("Expected GetImplicitRolesForUser() to be successful; got %v", err)
+	}
+	if want := []string{"data2_admin", "auditor", "staff", "employee"}; !reflect.DeepEqual(roles, want) {
+		t.Errorf("Expected roles %v; got %v", want, roles)
+	}
+
+	if roles, _ := a.GetImplicitRolesForUser("alice", 1); !reflect.DeepEqual(roles, []string{"data2_admin", "auditor"}) {
+		t.Errorf("Expected the direct roles only; got %v", roles)
+	}
+	if roles, _ := a.GetImplicitRolesForUser("alice", 2); !reflect.DeepEqual(roles, []string{"data2_admin", "auditor", "staff"}) {
+		t.Errorf("Expected two levels of roles; got %v", roles)
+	}
+	if roles, _ := a.GetImplicitRolesForUser("carol", 0); len(roles) != 0 {
+		t.Errorf("Expected no roles; got %v", roles)
+	}
+}
@@ -0,0 +1,492 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Schema describes how rules are stored as documents. Empty fields select the
+// default layout, which matches the bson tags of CasbinRule.
+type Schema struct {
+	// PType is the field holding the policy type. The default is "ptype".
+	PType string
+	// Values are the fields holding the rule values, in order. There must be
+	// at least six; more hold the values of longer rules. The default is
+	// "v0" to "v5".
+	Values []string
+	// Array, if set, is the field holding the rule values as an array, such
+	// as "values", instead of the fields in Values and Length. Rule values
+	// then keep naming the array positions, "v0" for "values.0" and so on.
+	// Rules stored in fields are moved to the array when the adapter
+	// connects.
+	Array string
+	// Length is the field holding the number of values of a rule, which
+	// keeps trailing empty values. The default is "len".
+	Length string
+	// Tenant is the field holding the tenant, see WithTenant. The default is
+	// "tenant".
+	Tenant string
+	// CreatedAt and UpdatedAt are the fields holding the time a rule was
+	// added and last modified, see WithTimestamps. The defaults are
+	// "created_at" and "updated_at".
+	CreatedAt string
+	UpdatedAt string
+	// DeletedAt is the field marking a deleted rule, see WithSoftDelete. The
+	// default is "deleted_at".
+	DeletedAt string
+	// Hash is the field holding the hash of a rule, see WithRuleHash. The
+	// default is "hash".
+	Hash string
+	// Meta is the field holding the metadata of a rule, see WithMetadata.
+	// The default is "meta".
+	Meta string
+	// ExpiresAt is the field holding the time a rule expires, see
+	// WithExpiry. The default is "expires_at".
+	ExpiresAt string
+	// NotBefore and NotAfter are the fields bounding the time a rule is
+	// active, see WithActivationWindows. The defaults are "not_before" and
+	// "not_after".
+	NotBefore string
+	NotAfter  string
+
+	// OmitEmpty leaves empty values out of the stored documents, instead of
+	// storing empty strings, and matches a missing value field as empty. It
+	// cannot be combined with Array.
+	OmitEmpty bool
+
+	// Extra, if set, returns fields stored in addition to the rule with
+	// every new document, such as a creation time. They are ignored when the
+	// policy is loaded.
+	Extra func() bson.D
+	// NewID, if set, returns the _id of a new document. By default the
+	// server assigns an ObjectID.
+	NewID func(ptype string, rule []string) interface{}
+}
+
+// defaultSchema is the layout used unless WithSchema is given.
+var defaultSchema = Schema{
+	PType:  "ptype",
+	Values: []string{"v0", "v1", "v2", "v3", "v4", "v5"},
+	Length: "len",
+	Tenant: "tenant",
+
+	CreatedAt: "created_at",
+	UpdatedAt: "updated_at",
+	DeletedAt: "deleted_at",
+	Hash:      "hash",
+	Meta:      "meta",
+	ExpiresAt: "expires_at",
+	NotBefore: "not_before",
+	NotAfter:  "not_after",
+}
+
+// PortableSchema is the layout of the policies stored by the casbin MongoDB
+// adapters for Python and Node.js, which name the fields as the default
+// layout does but leave empty values out. With WithSchema(PortableSchema),
+// services written in different languages share one policy collection.
+var PortableSchema = Schema{OmitEmpty: true}
+
+// WithSchema stores rules in the given document layout, for example with
+// snake_case field names and a created_at field:
+//
+//	mongodbadapter.WithSchema(mongodbadapter.Schema{
+//		PType:  "p_type",
+//		Values: []string{"v_0", "v_1", "v_2", "v_3", "v_4", "v_5"},
+//		Extra: func() bson.D {
+//			return bson.D{{Key: "created_at", Value: time.Now()}}
+//		},
+//	})
+//
+// WithFieldIndexes and Filter keep naming the fields "ptype", "v0" to "v5"
+// and "tenant"; they are mapped to the schema. The layout must not change
+// while rules are stored in the old one.
+func WithSchema(schema Schema) Option {
+	return func(a *Adapter) error {
+		if schema.PType == "" {
+			schema.PType = defaultSchema.PType
+		}
+		if schema.Values == nil {
+			schema.Values = defaultSchema.Values
+		}
+		if schema.Length == "" {
+			schema.Length = defaultSchema.Length
+		}
+		if schema.Tenant == "" {
+			schema.Tenant = defaultSchema.Tenant
+		}
+		if schema.CreatedAt == "" {
+			schema.CreatedAt = defaultSchema.CreatedAt
+		}
+		if schema.UpdatedAt == "" {
+			schema.UpdatedAt = defaultSchema.UpdatedAt
+		}
+		if schema.DeletedAt == "" {
+			schema.DeletedAt = defaultSchema.DeletedAt
+		}
+		if schema.Hash == "" {
+			schema.Hash = defaultSchema.Hash
+		}
+		if schema.Meta == "" {
+			schema.Meta = defaultSchema.Meta
+		}
+		if schema.ExpiresAt == "" {
+			schema.ExpiresAt = defaultSchema.ExpiresAt
+		}
+		if schema.NotBefore == "" {
+			schema.NotBefore = defaultSchema.NotBefore
+		}
+		if schema.NotAfter == "" {
+			schema.NotAfter = defaultSchema.NotAfter
+		}
+
+		if schema.OmitEmpty && schema.Array != "" {
+			return errors.New("schema cannot omit the empty values of an array")
+		}
+		if len(schema.Values) < len(defaultSchema.Values) {
+			return errors.New("schema must name at least six value fields")
+		}
+		seen := map[string]bool{"_id": true}
+		fields := append([]string{schema.PType, schema.Length, schema.Tenant, schema.CreatedAt, schema.UpdatedAt, schema.DeletedAt, schema.Hash, schema.Meta, schema.ExpiresAt, schema.NotBefore, schema.NotAfter}, schema.Values...)
+		if schema.Array != "" {
+			fields = append(fields, schema.Array)
+		}
+		for _, field := range fields {
+			if field == "" || seen[field] {
+				return errors.New("schema field names must be unique and not empty: " + field)
+			}
+			seen[field] = true
+		}
+
+		a.schema = schema
+		return nil
+	}
+}
+
+// A Serializer customizes how rules are stored, see WithSerializer, for
+// example to add fields computed from the rule, to normalize values or to
+// map rules to the documents of a legacy application. A Serializer must be
+// safe for concurrent use.
+type Serializer interface {
+	// Encode returns the fields storing the rule. fields holds them as laid
+	// out by the schema, with values encrypted, see WithEncryption; Encode
+	// may rewrite, rename or add fields. The returned fields are stored with
+	// new rules, and they also select the stored rule for RemovePolicy and
+	// UpdatePolicy, so they must only depend on the rule.
+	Encode(ptype string, rule []string, fields bson.D) bson.D
+	// Decode returns the rule stored in doc. ptype and rule are read as laid
+	// out by the schema, with values decrypted.
+	Decode(doc bson.Raw, ptype string, rule []string) (string, []string, error)
+}
+
+// WithSerializer converts rules to and from documents with s on top of the
+// schema. Filters, QueryPolicies and RemoveFilteredPolicy keep selecting
+// rules by the fields of the schema, so a Serializer that renames or rewrites
+// those fields limits them to the stored values.
+func WithSerializer(s Serializer) Option {
+	return func(a *Adapter) error {
+		if s == nil {
+			return errors.New("serializer must not be nil")
+		}
+		a.serializer = s
+		return nil
+	}
+}
+
+// field maps a rule field as used by the options and the Filter ("ptype",
+// "v0" to "v5" and "tenant") to the document field of the schema.
+func (s *Schema) field(name string) string {
+	switch name {
+	case "ptype":
+		return s.PType
+	case "tenant":
+		return s.Tenant
+	}
+	if strings.HasPrefix(name, "v") {
+		if i, err := strconv.Atoi(name[1:]); err == nil && i >= 0 && (s.Array != "" || i < len(s.Values)) {
+			return s.value(i)
+		}
+	}
+	return name
+}
+
+// ruleFields returns the rule fields of the schema as named by the options,
+// "ptype" followed by "v0" to the last value field.
+func (s *Schema) ruleFields() []string {
+	if s.Array != "" {
+		return ruleFields
+	}
+	fields := []string{"ptype"}
+	for i := range s.Values {
+		fields = append(fields, "v"+strconv.Itoa(i))
+	}
+	return fields
+}
+
+// value returns the document field holding the i-th rule value.
+func (s *Schema) value(i int) string {
+	if s.Array != "" {
+		return s.Array + "." + strconv.Itoa(i)
+	}
+	return s.Values[i]
+}
+
+// sparse splits the rule fields into the ones to store and the value fields
+// left out as empty, see Schema.OmitEmpty.
+func (s *Schema) sparse(fields bson.D) (bson.D, []string) {
+	if !s.OmitEmpty {
+		return fields, nil
+	}
+
+	stored := make(bson.D, 0, len(fields))
+	var empty []string
+	for _, e := range fields {
+		if e.Value == "" && s.isValue(e.Key) {
+			empty = append(empty, e.Key)
+			continue
+		}
+		stored = append(stored, e)
+	}
+	return stored, empty
+}
+
+// isValue reports whether the document field holds a rule value.
+func (s *Schema) isValue(field string) bool {
+	for _, v := range s.Values {
+		if v == field {
+			return true
+		}
+	}
+	return false
+}
+
+// fields returns the rule fields of the line as stored. The length is left
+// out, so that selectors match rules stored without it.
+func (a *Adapter) fields(line CasbinRule) bson.D {
+	values := a.encryptValues(line.toStringPolicy())
+
+	doc := make(bson.D, 0, len(a.schema.Values)+2)
+	doc = append(doc, bson.E{Key: a.schema.PType, Value: line.PType})
+	if a.schema.Array != "" {
+		doc = append(doc, bson.E{Key: a.schema.Array, Value: values})
+	} else {
+		// Missing values are stored empty, so that selectors match them.
+		for i, field := range a.schema.Values {
+			v := ""
+			if i < len(values) {
+				v = values[i]
+			}
+			doc = append(doc, bson.E{Key: field, Value: v})
+		}
+	}
+	if line.Tenant != "" {
+		doc = append(doc, bson.E{Key: a.schema.Tenant, Value: line.Tenant})
+	}
+	if a.serializer != nil {
+		doc = a.serializer.Encode(line.PType, line.toStringPolicy(), doc)
+	}
+	return doc
+}
+
+// document returns the document stored for a new rule.
+func (a *Adapter) document(line CasbinRule) bson.D {
+	doc := bson.D{}
+	if a.schema.NewID != nil {
+		doc = append(doc, bson.E{Key: "_id", Value: a.schema.NewID(line.PType, line.toStringPolicy())})
+	}
+	fields, _ := a.schema.sparse(a.fields(line))
+	doc = append(doc, fields...)
+	if a.schema.Array == "" {
+		doc = append(doc, bson.E{Key: a.schema.Length, Value: line.Len})
+	}
+	if a.ruleHash {
+		doc = append(doc, bson.E{Key: a.schema.Hash, Value: a.hash(line)})
+	}
+	if line.Meta != nil {
+		doc = append(doc, bson.E{Key: a.schema.Meta, Value: line.Meta})
+	}
+	if !line.ExpiresAt.IsZero() {
+		doc = append(doc, bson.E{Key: a.schema.ExpiresAt, Value: line.ExpiresAt})
+	}
+	if !line.NotBefore.IsZero() {
+		doc = append(doc, bson.E{Key: a.schema.NotBefore, Value: line.NotBefore})
+	}
+	if !line.NotAfter.IsZero() {
+		doc = append(doc, bson.E{Key: a.schema.NotAfter, Value: line.NotAfter})
+	}
+	if a.timestamps {
+		now := time.Now()
+		doc = append(doc, bson.E{Key: a.schema.CreatedAt, Value: now}, bson.E{Key: a.schema.UpdatedAt, Value: now})
+	}
+	if a.schema.Extra != nil {
+		doc = append(doc, a.schema.Extra()...)
+	}
+	return doc
+}
+
+// selector returns the selector matching exactly the stored rule of the line.
+func (a *Adapter) selector(line CasbinRule) bson.D {
+	var selector bson.D
+	if a.ruleHash {
+		selector = a.hashSelector(line)
+	} else {
+		var empty []string
+		selector, empty = a.schema.sparse(a.fields(line))
+		for _, field := range empty {
+			selector = append(selector, bson.E{Key: field, Value: bson.M{"$in": bson.A{"", nil}}})
+		}
+	}
+	if a.softDelete {
+		selector = append(selector, bson.E{Key: a.schema.DeletedAt, Value: bson.M{"$exists": false}})
+	}
+	return selector
+}
+
+// tombstone returns the update that marks rules deleted.
+func (a *Adapter) tombstone() bson.M {
+	return bson.M{"$set": bson.M{a.schema.DeletedAt: time.Now()}}
+}
+
+// update returns the update that overwrites a stored rule with the line.
+func (a *Adapter) update(line CasbinRule) bson.M {
+	set, empty := a.schema.sparse(a.fields(line))
+	if a.schema.Array == "" {
+		set = append(set, bson.E{Key: a.schema.Length, Value: line.Len})
+	}
+	if a.ruleHash {
+		set = append(set, bson.E{Key: a.schema.Hash, Value: a.hash(line)})
+	}
+	if a.timestamps {
+		set = append(set, bson.E{Key: a.schema.UpdatedAt, Value: time.Now()})
+	}
+	if len(empty) == 0 {
+		return bson.M{"$set": set}
+	}
+
+	unset := bson.M{}
+	for _, field := range empty {
+		unset[field] = ""
+	}
+	return bson.M{"$set": set, "$unset": unset}
+}
+
+// decodeLine reads a stored document, ignoring whether it is deleted,
+// decrypts its values, see WithEncryption, and passes it to the serializer,
+// see WithSerializer.
+func (a *Adapter) decodeLine(doc bson.Raw) (CasbinRule, error) {
+	line := a.decodeStored(doc)
+	a.sawTenant(line.Tenant)
+	if a.encryptor == nil && a.serializer == nil {
+		return line, nil
+	}
+
+	ptype, values := line.PType, line.toStringPolicy()
+	if a.encryptor != nil {
+		if err := a.decryptValues(values); err != nil {
+			return CasbinRule{}, err
+		}
+	}
+	if a.serializer != nil {
+		var err error
+		ptype, values, err = a.serializer.Decode(doc, ptype, values)
+		if err != nil {
+			return CasbinRule{}, err
+		}
+	}
+	decoded := savePolicyLine(ptype, values)
+	decoded.Tenant = line.Tenant
+	return decoded, nil
+}
+
+// decodeStored reads a stored document as it is stored. Fields that are
+// missing or not strings are read as empty values. Rules stored in fields are
+// read even with an array schema.
+func (a *Adapter) decodeStored(doc bson.Raw) CasbinRule {
+	str := func(field string) string {
+		v, _ := doc.Lookup(field).StringValueOK()
+		return v
+	}
+
+	if a.schema.Array != "" {
+		if array, ok := doc.Lookup(a.schema.Array).ArrayOK(); ok {
+			elems, _ := array.Values()
+			values := make([]string, len(elems))
+			for i, elem := range elems {
+				values[i], _ = elem.StringValueOK()
+			}
+			line := savePolicyLine(str(a.schema.PType), values)
+			line.Tenant = str(a.schema.Tenant)
+			return line
+		}
+	}
+	values := make([]string, len(a.schema.Values))
+	for i, field := range a.schema.Values {
+		values[i] = str(field)
+	}
+	line := savePolicyLine(str(a.schema.PType), values)
+	n, _ := doc.Lookup(a.schema.Length).AsInt64OK()
+	line.Len = int(n)
+	line.Tenant = str(a.schema.Tenant)
+	return line
+}
+
+// migrateToArray moves the values of rules stored in fields into the array of
+// the schema, see Schema.Array.
+func (a *Adapter) migrateToArray(ctx context.Context) error {
+	selector := bson.M{a.schema.PType: bson.M{"$exists": true}, a.schema.Array: bson.M{"$exists": false}}
+	cursor, err := a.collection.Find(ctx, selector)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	unset := bson.D{{Key: a.schema.Length, Value: ""}}
+	for _, field := range a.schema.Values {
+		unset = append(unset, bson.E{Key: field, Value: ""})
+	}
+
+	var models []mongo.WriteModel
+	for cursor.Next(ctx) {
+		line := a.decodeStored(cursor.Current)
+		update := bson.D{
+			{Key: "$set", Value: bson.D{{Key: a.schema.Array, Value: line.toStringPolicy()}}},
+			{Key: "$unset", Value: unset},
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: cursor.Current.Lookup("_id")}}).
+			SetUpdate(update))
+
+		if len(models) == migrateBatchSize {
+			if err := a.bulkWrite(ctx, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(models) > 0 {
+		return a.bulkWrite(ctx, models)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SlowOperation describes an operation that took longer than the threshold
+// set with WithSlowOperationThreshold.
+type SlowOperation struct {
+	// Operation is the name of the operation, such as "LoadPolicy".
+	Operation string
+	// Collection is the policy collection.
+	Collection string
+	// Duration is the time the operation took.
+	Duration time.Duration
+	// Shape is the selector of the first query of the operation, as
+	// extended JSON with every value replaced by "?", such as
+	// {"ptype":"?","v0":{"$in":"?"}}. It is empty if the operation did not
+	// query the collection.
+	Shape string
+	// Documents is the number of documents the operation read or wrote.
+	Documents int64
+	// Err is the error of the operation, if any.
+	Err error
+}
+
+// SlowOperationObserver may be implemented by the Metrics of the adapter to
+// receive the slow operations, see WithSlowOperationThreshold.
+type SlowOperationObserver interface {
+	ObserveSlowOperation(op SlowOperation)
+}
+
+// opStats collects the queries of an operation for the report of a slow
+// operation.
+type opStats struct {
+	mu        sync.Mutex
+	selector  interface{}
+	documents int64
+}
+
+type opStatsKey struct{}
+
+// withOpStats returns a context collecting the queries of an operation, if
+// slow operations are reported.
+func (a *Adapter) withOpStats(ctx context.Context) (context.Context, *opStats) {
+	if a.slowThreshold <= 0 {
+		return ctx, nil
+	}
+	stats := &opStats{}
+	return context.WithValue(ctx, opStatsKey{}, stats), stats
+}
+
+// observeQuery records a query of the operation in ctx and the number of
+// documents it read or wrote.
+func observeQuery(ctx context.Context, selector interface{}, documents int64) {
+	stats, ok := ctx.Value(opStatsKey{}).(*opStats)
+	if !ok {
+		return
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.selector == nil {
+		stats.selector = selector
+	}
+	stats.documents += documents
+}
+
+// reportSlow reports the operation if it took longer than the threshold.
+func (a *Adapter) reportSlow(op string, duration time.Duration, stats *opStats, err error) {
+	if stats == nil || duration < a.slowThreshold {
+		return
+	}
+
+	stats.mu.Lock()
+	slow := SlowOperation{
+		Operation:  op,
+		Collection: a.collectionName,
+		Duration:   duration,
+		Shape:      queryShape(stats.selector),
+		Documents:  stats.documents,
+		Err:        err,
+	}
+	stats.mu.Unlock()
+
+	a.debug("slow operation", "op", op, "duration", duration, "shape", slow.Shape, "documents", slow.Documents)
+	if observer, ok := a.metrics.(SlowOperationObserver); ok {
+		observer.ObserveSlowOperation(slow)
+	}
+}
+
+// queryShape returns the selector as extended JSON with its values replaced,
+// so that queries differing only in their values have the same shape.
+func queryShape(selector interface{}) string {
+	if selector == nil {
+		return ""
+	}
+	data, err := bson.MarshalExtJSON(shapeOf(selector), false, false)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func shapeOf(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		// Sorted, as maps have no order.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		shape := make(bson.D, 0, len(v))
+		for _, k := range keys {
+			shape = append(shape, bson.E{Key: k, Value: shapeOf(v[k])})
+		}
+		return shape
+	case bson.D:
+		shape := make(bson.D, 0, len(v))
+		for _, e := range v {
+			shape = append(shape, bson.E{Key: e.Key, Value: shapeOf(e.Value)})
+		}
+		return shape
+	case bson.A:
+		// The operands of $and and $or keep their shapes.
+		shape := make(bson.A, 0, len(v))
+		for _, e := range v {
+			if _, ok := e.(bson.M); ok {
+				shape = append(shape, shapeOf(e))
+			} else if _, ok := e.(bson.D); ok {
+				shape = append(shape, shapeOf(e))
+			}
+		}
+		if len(shape) == 0 {
+			return "?"
+		}
+		return shape
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// reconnectInterval is the time between the attempts of an adapter started
+// from its snapshot file to reach the server.
+const reconnectInterval = 5 * time.Second
+
+// openOffline connects an adapter to a server that cannot be reached at the
+// moment, if there is a snapshot file to start from. It keeps trying to reach
+// the server in the background. If there is no snapshot, it returns cause.
+func (a *Adapter) openOffline(cause error) error {
+	if _, err := os.Stat(a.snapshotFile); err != nil {
+		return cause
+	}
+
+	// The driver connects lazily, so this succeeds while the server is down.
+	client, err := a.connect(context.Background(), a.credential)
+	if err != nil {
+		return err
+	}
+	a.client = client
+	a.ownsClient = true
+	a.selectCollections()
+
+	a.online = make(chan struct{})
+	a.reconnecting = make(chan struct{})
+	a.debug("server unreachable, starting from snapshot", "file", a.snapshotFile, "error", cause)
+	go a.reconnect(a.online, a.reconnecting)
+	return nil
+}
+
+// reconnect pings the server until it answers and the collection is
+// prepared, then closes online. It gives up when stop is closed.
+func (a *Adapter) reconnect(online, stop chan struct{}) {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		err := a.Ping(ctx)
+		if err == nil {
+			err = a.prepare(ctx)
+		}
+		cancel()
+		if err != nil {
+			a.debug("server still unreachable", "error", err)
+			continue
+		}
+
+		a.debug("server reachable again", "collection", a.collectionName)
+		close(online)
+		return
+	}
+}
+
+// offline reports whether the adapter started from its snapshot file and has
+// not reached the server yet.
+func (a *Adapter) offline() bool {
+	if a.online == nil {
+		return false
+	}
+	select {
+	case <-a.online:
+		return false
+	default:
+		return true
+	}
+}
+
+// loadSnapshot loads the policy from the snapshot file.
+func (a *Adapter) loadSnapshot(model model.Model) error {
+	file, err := os.Open(a.snapshotFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	rules := 0
+	err = readCSV(r, func(ptype string, rule []string) error {
+		if err := a.decryptValues(rule); err != nil {
+			return err
+		}
+		rules++
+		loadPolicyLine(a.ruleLine(ptype, rule), model)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	a.debug("loaded policy from snapshot", "file", a.snapshotFile, "count", rules)
+	a.rulesLoaded("LoadPolicy", rules)
+	return nil
+}
+
+// saveSnapshot writes the rules of a full load to the snapshot file. The file
+// is replaced as a whole, so that a failed write leaves the previous snapshot
+// in place. As the load has succeeded, a failure is only logged.
+func (a *Adapter) saveSnapshot(lines []CasbinRule) {
+	if err := a.writeSnapshot(lines); err != nil {
+		a.debug("writing snapshot failed", "file", a.snapshotFile, "error", err)
+	}
+}
+
+func (a *Adapter) writeSnapshot(lines []CasbinRule) error {
+	file, err := os.CreateTemp(filepath.Dir(a.snapshotFile), filepath.Base(a.snapshotFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := gzip.NewWriter(file)
+	buf := bufio.NewWriter(w)
+	for _, line := range lines {
+		// Encrypted values stay encrypted on disk.
+		if _, err := buf.WriteString(csvLine(line.PType, a.encryptValues(line.toStringPolicy()))); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), a.snapshotFile)
+}
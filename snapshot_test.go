@@ -0,0 +1,95 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdapterWithSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv.gz")
+	a := newTestAdapter(t, "casbin_rule_snapshot", WithSnapshotFile(path))
+
+	if err := a.AddPolicies("p", "p", [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil {
+		t.Fatalf("Expected AddPolicies() to be successful; got %v", err)
+	}
+	newEnforcer(t, "examples/rbac_model.conf", a)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected LoadPolicy() to write the snapshot; got %v", err)
+	}
+
+	if testing.Short() {
+		t.Skip("skipping start without a server in short mode")
+	}
+
+	// An unreachable server starts the adapter from the snapshot.
+	offline, err := NewAdapterWithError("127.0.0.1:1", WithSnapshotFile(path))
+	if err != nil {
+		t.Fatalf("Expected NewAdapterWithError() to start from the snapshot; got %v", err)
+	}
+	defer offline.Close()
+
+	e := newEnforcer(t, "examples/rbac_model.conf", offline)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	if err := offline.AddPolicy("p", "p", []string{"carol", "data3", "read"}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected AddPolicy() to fail with ErrNotConnected; got %v", err)
+	}
+
+	if _, err := NewAdapterWithError("127.0.0.1:1", WithSnapshotFile(path+".missing")); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected NewAdapterWithError() to fail without a snapshot; got %v", err)
+	}
+}
+
+func TestSnapshotKeepsValuesEncrypted(t *testing.T) {
+	enc, err := NewAESEncryptor(make([]byte, 64))
+	if err != nil {
+		t.Fatalf("Expected NewAESEncryptor() to be successful; got %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.csv.gz")
+	a, err := newAdapter([]Option{WithEncryption(enc, "v0"), WithSnapshotFile(path)})
+	if err != nil {
+		t.Fatalf("Expected newAdapter() to be successful; got %v", err)
+	}
+
+	if err := a.writeSnapshot([]CasbinRule{a.ruleLine("p", []string{"alice", "data1", "read"})}); err != nil {
+		t.Fatalf("Expected writeSnapshot() to be successful; got %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := io.ReadAll(r); bytes.Contains(file, []byte("alice")) {
+		t.Errorf("Expected the snapshot not to hold encrypted values in plain text; got %q", file)
+	}
+
+	m := newModel(t, "examples/rbac_model.conf")
+	if err := a.loadSnapshot(m); err != nil {
+		t.Fatalf("Expected loadSnapshot() to be successful; got %v", err)
+	}
+	if policy := findAssertion(m, "p").Policy; len(policy) != 1 || policy[0][0] != "alice" {
+		t.Errorf("Expected the snapshot to load the decrypted rule; got %v", policy)
+	}
+}
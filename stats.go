@@ -0,0 +1,114 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Stats describes the stored policy, see Adapter.Stats.
+type Stats struct {
+	// Rules is the number of rules of the adapter's tenant, if any, not
+	// counting deleted ones.
+	Rules int64
+	// RulesByType is the number of rules of each policy type.
+	RulesByType map[string]int64
+	// Documents is the number of documents in the collection, including the
+	// rules of other tenants and deleted rules.
+	Documents int64
+	// IndexSizes is the size of each index of the collection in bytes.
+	IndexSizes map[string]int64
+	// LastModified is the time the latest rule was added or modified. It
+	// requires WithTimestamps, and is zero otherwise.
+	LastModified time.Time
+}
+
+// Stats returns the number of rules by policy type, the size of the
+// collection and its indexes, and when the rules were last modified, for
+// example for a dashboard.
+func (a *Adapter) Stats() (*Stats, error) {
+	return a.StatsCtx(context.Background())
+}
+
+// StatsCtx is like Stats but honors the deadline and cancellation of ctx.
+func (a *Adapter) StatsCtx(ctx context.Context) (stats *Stats, err error) {
+	ctx, end := a.begin(ctx, "Stats")
+	defer func() { err = end(err) }()
+
+	stats = &Stats{RulesByType: map[string]int64{}, IndexSizes: map[string]int64{}}
+
+	cursor, err := a.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: a.scope(bson.M{})}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$" + a.schema.PType,
+			"rules":   bson.M{"$sum": 1},
+			"updated": bson.M{"$max": "$" + a.schema.UpdatedAt},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			PType   string    `bson:"_id"`
+			Rules   int64     `bson:"rules"`
+			Updated time.Time `bson:"updated"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return nil, err
+		}
+		stats.Rules += group.Rules
+		stats.RulesByType[group.PType] += group.Rules
+		if group.Updated.After(stats.LastModified) {
+			stats.LastModified = group.Updated
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// A sharded collection reports the statistics of each shard.
+	cursor, err = a.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.M{"storageStats": bson.M{}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var shard struct {
+			StorageStats struct {
+				Count      int64            `bson:"count"`
+				IndexSizes map[string]int64 `bson:"indexSizes"`
+			} `bson:"storageStats"`
+		}
+		if err := cursor.Decode(&shard); err != nil {
+			return nil, err
+		}
+		stats.Documents += shard.StorageStats.Count
+		for name, size := range shard.StorageStats.IndexSizes {
+			stats.IndexSizes[name] += size
+		}
+	}
+
+	return stats, cursor.Err()
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_stats", WithTimestamps())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	stats, err := a.Stats()
+	if err != nil {
+		t.Fatalf("Expected Stats() to be successful; got %v", err)
+	}
+	if stats.Rules != 5 || stats.RulesByType["p"] != 4 || stats.RulesByType["g"] != 1 {
+		t.Errorf("Expected 4 p and 1 g rules; got %+v", stats)
+	}
+	if stats.Documents != 5 {
+		t.Errorf("Expected 5 documents; got %d", stats.Documents)
+	}
+	if _, ok := stats.IndexSizes["_id_"]; !ok {
+		t.Errorf("Expected the size of the _id index; got %v", stats.IndexSizes)
+	}
+	if stats.LastModified.IsZero() {
+		t.Errorf("Expected the time of the last modification")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+)
+
+// SwitchCollection points the adapter at another policy collection, such as
+// the green one of a blue/green deployment, without constructing a new
+// adapter. An empty database keeps the current one. The new collection is
+// prepared first, with its indexes created as the options ask for, while
+// operations carry on against the current one; the adapter then switches
+// over once the operations in progress are done. Operations started
+// afterwards all use the new collection.
+//
+// The adapter forgets the filter of the last load and its cache, so reload
+// the policy after switching. A Watcher of the adapter moves to the new
+// collection and calls its callback with "reconnect", and views created with
+// WithTenant move along.
+func (a *Adapter) SwitchCollection(database, collection string) error {
+	return a.SwitchCollectionCtx(context.Background(), database, collection)
+}
+
+// SwitchCollectionCtx is like SwitchCollection but honors the deadline and cancellation of ctx.
+func (a *Adapter) SwitchCollectionCtx(ctx context.Context, database, collection string) error {
+	if collection == "" {
+		return errors.New("collection name must not be empty")
+	}
+
+	// The new collection is prepared on a copy of the connection, which the
+	// adapter and its views move to once it is ready.
+	a.connMu.RLock()
+	conn := *a.connection
+	a.connMu.RUnlock()
+	next := *a
+	next.connection = &conn
+	conn.tenantRules = new(int32)
+	if database != "" {
+		next.databaseName = database
+	}
+	next.collectionName = collection
+	next.selectCollections()
+	if err := next.prepare(ctx); err != nil {
+		return classify(err)
+	}
+
+	a.connMu.Lock()
+	a.databaseName, a.collectionName = next.databaseName, next.collectionName
+	a.collection, a.loads = next.collection, next.loads
+	a.history, a.auditLog = next.history, next.auditLog
+	a.tenantRules = next.tenantRules
+	a.connMu.Unlock()
+
+	a.setFilter(nil, false)
+	if a.cache != nil {
+		a.cache.invalidate()
+	}
+	a.debug("switched collection", "database", next.databaseName, "collection", collection)
+	return nil
+}
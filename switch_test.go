@@ -0,0 +1,54 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+)
+
+func TestSwitchCollection(t *testing.T) {
+	green := newTestAdapter(t, "casbin_rule_green")
+	green.AddPolicy("p", "p", []string{"bob", "data2", "write"})
+
+	a := newTestAdapter(t, "casbin_rule_blue")
+	a.AddPolicy("p", "p", []string{"alice", "data1", "read"})
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+	view := a.WithTenant("")
+
+	if err := a.SwitchCollection("", "casbin_rule_green"); err != nil {
+		t.Fatalf("Expected SwitchCollection() to be successful; got %v", err)
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}})
+	// Views move along with the adapter.
+	if rules, err := view.GetPolicies("p", 0); err != nil || len(rules) != 1 || rules[0][0] != "bob" {
+		t.Errorf("Expected the view to use the new collection; got %v, %v", rules, err)
+	}
+
+	if err := a.SwitchCollection("", "casbin_rule_blue"); err != nil {
+		t.Fatalf("Expected SwitchCollection() to be successful; got %v", err)
+	}
+	if err := a.SwitchCollection("", ""); err == nil {
+		t.Error("Expected SwitchCollection() to reject an empty collection name")
+	}
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("Expected LoadPolicy() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrFullReloadRequired is returned by Sync.Apply when the recorded changes
+// cannot be replayed, for example because the collection was replaced by
+// SavePolicy or a removed rule is unknown. The policy must then be loaded in
+// full, followed by a call to Sync.Reset.
+var ErrFullReloadRequired = errors.New("policy changes cannot be replayed, reload the policy")
+
+// Sync keeps a model in step with the stored policy by replaying the rule
+// changes recorded in the collection's change stream, instead of reloading
+// the whole policy. It remembers the position in the stream as a resume
+// token, which can be persisted to continue after a restart.
+//
+// Removed rules can only be replayed if the collection records pre-images,
+// which requires MongoDB 6.0 or later; see EnablePreImages. Change streams
+// require a replica set or a sharded cluster.
+type Sync struct {
+	adapter *Adapter
+	token   bson.Raw
+}
+
+// NewSync is the constructor for Sync. It continues after the given resume
+// token, or starts at the current end of the stream if token is nil. When
+// starting anew, create the Sync before loading the policy, so that no
+// change falls between the load and the first Apply.
+func NewSync(ctx context.Context, a *Adapter, token bson.Raw) (*Sync, error) {
+	s := &Sync{adapter: a, token: token}
+	if token == nil {
+		if err := s.Reset(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// EnablePreImages makes the server record the previous version of changed
+// and removed rules, which Sync needs to replay removals. The user needs the
+// collMod privilege on the collection.
+func (a *Adapter) EnablePreImages(ctx context.Context) error {
+	cmd := bson.D{
+		{Key: "collMod", Value: a.collection.Name()},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": true}},
+	}
+	return a.collection.Database().RunCommand(ctx, cmd).Err()
+}
+
+// ResumeToken returns the position in the change stream up to which changes
+// have been applied.
+func (s *Sync) ResumeToken() bson.Raw {
+	return s.token
+}
+
+// Reset moves the position to the current end of the change stream,
+// discarding all pending changes. Call it before a full reload.
+func (s *Sync) Reset(ctx context.Context) error {
+	stream, err := s.adapter.collection.Watch(ctx, s.pipeline())
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+
+	s.token = stream.ResumeToken()
+	return nil
+}
+
+// Apply replays the changes since the last call on the model, and reports
+// whether the model changed. Grouping policy changes require the role links
+// to be rebuilt, for example with the enforcer's BuildRoleLinks. If Apply
+// returns ErrFullReloadRequired, the model may be partially updated.
+func (s *Sync) Apply(ctx context.Context, model model.Model) (bool, error) {
+	opts := options.ChangeStream().
+		SetResumeAfter(s.token).
+		SetFullDocument(options.WhenAvailable).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+
+	stream, err := s.adapter.collection.Watch(ctx, s.pipeline(), opts)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close(ctx)
+
+	changed := false
+	for stream.TryNext(ctx) {
+		var event struct {
+			OperationType string   `bson:"operationType"`
+			After         bson.Raw `bson:"fullDocument"`
+			Before        bson.Raw `bson:"fullDocumentBeforeChange"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return changed, err
+		}
+
+		switch event.OperationType {
+		case "insert":
+			added, err := s.apply(model, event.After, true)
+			if err != nil {
+				return changed, err
+			}
+			changed = added || changed
+		case "delete", "update", "replace":
+			if event.Before == nil || (event.OperationType != "delete" && event.After == nil) {
+				return changed, ErrFullReloadRequired
+			}
+			// Deleted rules are neither removed nor added, so marking a rule
+			// deleted removes it and purging it has no effect.
+			removed, err := s.apply(model, event.Before, false)
+			if err != nil {
+				return changed, err
+			}
+			added, err := s.apply(model, event.After, true)
+			if err != nil {
+				return changed, err
+			}
+			changed = removed || added || changed
+		default:
+			// drop, rename and invalidate replace the whole policy.
+			return changed, ErrFullReloadRequired
+		}
+
+		s.token = stream.ResumeToken()
+	}
+	if err := stream.Err(); err != nil {
+		return changed, err
+	}
+
+	// The stream may have advanced past events of other collections.
+	if token := stream.ResumeToken(); token != nil {
+		s.token = token
+	}
+	return changed, nil
+}
+
+// pipeline limits the stream to the adapter's tenant, if it has one. Events
+// that concern the whole collection are always kept, and so are changes of
+// rules without a pre-image, whose tenant is unknown, so that Apply asks for
+// a full reload.
+func (s *Sync) pipeline() mongo.Pipeline {
+	if s.adapter.tenant == "" {
+		return mongo.Pipeline{}
+	}
+
+	return mongo.Pipeline{{{Key: "$match", Value: bson.M{"$or": bson.A{
+		bson.M{"fullDocument." + s.adapter.schema.Tenant: s.adapter.tenant},
+		bson.M{"fullDocumentBeforeChange." + s.adapter.schema.Tenant: s.adapter.tenant},
+		bson.M{"operationType": bson.M{"$in": bson.A{"drop", "rename", "dropDatabase", "invalidate"}}},
+		bson.M{
+			"operationType":            bson.M{"$in": bson.A{"delete", "update", "replace"}},
+			"fullDocumentBeforeChange": nil,
+		},
+	}}}}}
+}
+
+// line decodes a document of a change event, which is missing when the
+// server could not provide it. Deleted rules are reported as missing.
+func (s *Sync) line(doc bson.Raw) (*CasbinRule, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	if _, err := doc.LookupErr(s.adapter.schema.DeletedAt); err == nil {
+		return nil, nil
+	}
+	line, err := s.adapter.decodeLine(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// apply adds the rule of a document of a change event to or removes it from
+// the model, and reports whether the model changed. As on load, rules that
+// have expired or are outside their activation window are not added.
+func (s *Sync) apply(model model.Model, doc bson.Raw, add bool) (bool, error) {
+	line, err := s.line(doc)
+	if err != nil || line == nil {
+		return false, err
+	}
+
+	sec, ok := findSection(model, line.PType)
+	if !ok {
+		return false, nil
+	}
+	rule := line.toStringPolicy()
+	if !add {
+		return model.RemovePolicy(sec, line.PType, rule)
+	}
+	if !s.adapter.isActive(doc, time.Now()) {
+		return false, nil
+	}
+	if found, err := model.HasPolicy(sec, line.PType, rule); err != nil || found {
+		return false, err
+	}
+	return true, model.AddPolicy(sec, line.PType, rule)
+}
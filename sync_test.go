@@ -0,0 +1,135 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSync(t *testing.T) {
+	initPolicy(t)
+
+	a := NewAdapter(getDbURL()).(*Adapter)
+	ctx := context.Background()
+	defer a.dropTable(ctx)
+	requireReplicaSet(t, a)
+
+	if err := a.EnablePreImages(ctx); err != nil {
+		t.Skipf("Pre-images are not supported by the test server: %v", err)
+	}
+
+	s, err := NewSync(ctx, a, nil)
+	if err != nil {
+		t.Fatalf("Expected NewSync() to be successful; got %v", err)
+	}
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+
+	// Changes made elsewhere are replayed without reloading.
+	other := NewAdapter(getDbURL())
+	if err := other.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := other.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+
+	changed, err := s.Apply(ctx, e.GetModel())
+	if err != nil {
+		t.Errorf("Expected Apply() to be successful; got %v", err)
+	}
+	if !changed {
+		t.Error("Expected Apply() to change the model")
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"carol", "data3", "read"}})
+
+	// Nothing new happened since.
+	if changed, err := s.Apply(ctx, e.GetModel()); err != nil || changed {
+		t.Errorf("Expected Apply() to be a no-op; got %v, %v", changed, err)
+	}
+
+	// A resumed Sync continues where the last one stopped.
+	resumed, err := NewSync(ctx, a, s.ResumeToken())
+	if err != nil {
+		t.Fatalf("Expected NewSync() to be successful; got %v", err)
+	}
+
+	// Replacing the collection cannot be replayed.
+	if err := e.SavePolicy(); err != nil {
+		t.Errorf("Expected SavePolicy() to be successful; got %v", err)
+	}
+	if _, err := resumed.Apply(ctx, e.GetModel()); err != ErrFullReloadRequired {
+		t.Errorf("Expected ErrFullReloadRequired; got %v", err)
+	}
+	if err := resumed.Reset(ctx); err != nil {
+		t.Errorf("Expected Reset() to be successful; got %v", err)
+	}
+}
+
+func TestSyncTenantWithoutPreImages(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_sync_tenant", WithTenant("acme"))
+	ctx := context.Background()
+	requireReplicaSet(t, a)
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	s, err := NewSync(ctx, a, nil)
+	if err != nil {
+		t.Fatalf("Expected NewSync() to be successful; got %v", err)
+	}
+
+	// Without a pre-image the tenant of a removed rule is unknown.
+	if err := a.RemovePolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Fatalf("Expected RemovePolicy() to be successful; got %v", err)
+	}
+	m := newModel(t, "examples/rbac_model.conf")
+	if _, err := s.Apply(ctx, m); err != ErrFullReloadRequired {
+		t.Errorf("Expected ErrFullReloadRequired; got %v", err)
+	}
+}
+
+func TestSyncSkipsInactiveRules(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_sync_windows", WithActivationWindows())
+	ctx := context.Background()
+	requireReplicaSet(t, a)
+
+	if err := a.EnablePreImages(ctx); err != nil {
+		t.Skipf("Pre-images are not supported by the test server: %v", err)
+	}
+	s, err := NewSync(ctx, a, nil)
+	if err != nil {
+		t.Fatalf("Expected NewSync() to be successful; got %v", err)
+	}
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+
+	// Only the rule active now is replayed, as it would be loaded.
+	now := time.Now()
+	if err := a.AddPolicyWithWindow("p", "p", []string{"alice", "data1", "read"}, now.Add(-time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"bob", "data2", "write"}, now.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+	if err := a.AddPolicyWithWindow("p", "p", []string{"carol", "data3", "read"}, time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Expected AddPolicyWithWindow() to be successful; got %v", err)
+	}
+
+	if _, err := s.Apply(ctx, e.GetModel()); err != nil {
+		t.Errorf("Expected Apply() to be successful; got %v", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// withTimeout applies the timeout configured for the kind of operation op, if
+// any. The returned function must be called when the operation is done.
+func (a *Adapter) withTimeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	if timeout := a.operationTimeout(op); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func() {}
+}
+
+// operationTimeout returns the timeout of the operation op, or 0 if it has
+// none.
+func (a *Adapter) operationTimeout(op string) time.Duration {
+	switch op {
+	case "LoadPolicy", "LoadFilteredPolicy", "LoadPolicyStream", "GridFSLoadPolicy":
+		return a.loadTimeout
+	case "SavePolicy", "GridFSSavePolicy", "ImportPolicyCSV", "MigrateFrom", "RestoreVersion":
+		return a.saveTimeout
+	}
+	if strings.HasPrefix(op, "Add") || strings.HasPrefix(op, "Remove") || strings.HasPrefix(op, "Update") {
+		return a.mutationTimeout
+	}
+	return 0
+}
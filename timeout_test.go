@@ -0,0 +1,40 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOperationTimeouts(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_timeout", WithLoadTimeout(time.Nanosecond), WithMutationTimeout(time.Minute))
+
+	// The short load timeout must not affect single rule changes.
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	if err := a.LoadPolicy(newModel(t, "examples/rbac_model.conf")); err == nil {
+		t.Error("Expected LoadPolicy() to time out")
+	}
+
+	if got := a.operationTimeout("RemoveFilteredPolicy"); got != time.Minute {
+		t.Errorf("Expected the mutation timeout for RemoveFilteredPolicy; got %v", got)
+	}
+	if got := a.operationTimeout("Stats"); got != 0 {
+		t.Errorf("Expected no timeout for Stats; got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the adapter as the instrumentation library of its
+// spans.
+const tracerName = "github.com/casbin/mongodb-adapter/v2"
+
+// begin instruments an operation: it starts a span for it, as a child of the
+// span in ctx, if any. The returned context carries the span, and the
+// returned function must be called with the result of the operation when it
+// completes. It returns the error to report to the caller, see classify.
+func (a *Adapter) begin(ctx context.Context, op string) (context.Context, func(err error) error) {
+	start := time.Now()
+	a.connMu.RLock()
+	ctx, cancel := a.withTimeout(ctx, op)
+	ctx, stats := a.withOpStats(ctx)
+
+	// While the circuit is open, the operation runs with a canceled context,
+	// so it fails before it reaches the server.
+	open := a.breaker != nil && !a.breaker.allow()
+	if open {
+		var stop context.CancelFunc
+		ctx, stop = context.WithCancel(ctx)
+		stop()
+	}
+	ctx, span := a.tracer.Start(ctx, "casbin.mongodb."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", a.databaseName),
+			attribute.String("db.mongodb.collection", a.collectionName),
+			attribute.String("db.operation", op),
+		))
+
+	return ctx, func(err error) error {
+		err = classify(err)
+		switch {
+		case open && err != nil:
+			err = ErrCircuitOpen
+		case a.breaker != nil && !open:
+			a.breaker.record(err)
+		}
+		duration := time.Since(start)
+		a.debug("operation finished", "op", op, "duration", duration, "error", err)
+		if a.metrics != nil {
+			a.metrics.ObserveOperation(op, duration, err)
+		}
+		a.reportSlow(op, duration, stats, err)
+
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		cancel()
+		a.connMu.RUnlock()
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	initPolicy(t)
+
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	a := newTestAdapter(t, defaultCollectionName, WithTracerProvider(tp))
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	e.AddPolicy("carol", "data3", "read")
+	a.UpdatePolicies("p", "p", [][]string{{"carol", "data3", "read"}}, nil)
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans; got %d", len(spans))
+	}
+	if name := spans[1].Name(); name != "casbin.mongodb.AddPolicy" {
+		t.Errorf("Expected an AddPolicy span; got %s", name)
+	}
+	found := false
+	for _, kv := range spans[1].Attributes() {
+		if kv.Key == "db.system" && kv.Value.AsString() == "mongodb" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the db.system attribute; got %v", spans[1].Attributes())
+	}
+	if status := spans[2].Status(); status.Code != codes.Error {
+		t.Errorf("Expected the failed operation to set an error status; got %v", status)
+	}
+}
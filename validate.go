@@ -0,0 +1,76 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// validateRule checks that the schema can store the rule, and the rule
+// against the model set with WithValidation, if any. The rule must belong to
+// a policy type of the model and have as many values as its definition, such
+// as three for "p = sub, obj, act" and two for "g = _, _".
+func (a *Adapter) validateRule(ptype string, rule []string) error {
+	if a.schema.Array == "" && len(rule) > len(a.schema.Values) {
+		return &wrappedError{sentinel: ErrInvalidRule, err: errors.New(ptype + " rule [" + strings.Join(rule, ", ") + "] has " +
+			strconv.Itoa(len(rule)) + " values, the schema stores at most " + strconv.Itoa(len(a.schema.Values)))}
+	}
+	if a.validation == nil {
+		return nil
+	}
+
+	ast := findAssertion(a.validation, ptype)
+	if ast == nil {
+		return &wrappedError{sentinel: ErrInvalidRule, err: errors.New("policy type " + strconv.Quote(ptype) + " is not defined by the model")}
+	}
+	if want := ruleArity(ast); len(rule) != want {
+		return &wrappedError{sentinel: ErrInvalidRule, err: errors.New(ptype + " rule [" + strings.Join(rule, ", ") + "] has " +
+			strconv.Itoa(len(rule)) + " values, the model defines " + strconv.Itoa(want))}
+	}
+	return nil
+}
+
+// validateRules is like validateRule for several rules of the same type.
+func (a *Adapter) validateRules(ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if err := a.validateRule(ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateModel is like validateRule for every rule of the model.
+func (a *Adapter) validateModel(m model.Model) error {
+	for _, ptype := range policyTypes(m) {
+		if err := a.validateRules(ptype, findAssertion(m, ptype).Policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ruleArity returns the number of values of the rules of an assertion. Policy
+// definitions list their tokens, role definitions an underscore per value.
+func ruleArity(ast *model.Assertion) int {
+	if len(ast.Tokens) > 0 {
+		return len(ast.Tokens)
+	}
+	return strings.Count(ast.Value, "_")
+}
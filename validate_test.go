@@ -0,0 +1,53 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	m := newModel(t, "examples/rbac_model.conf")
+	a := newTestAdapter(t, "casbin_rule_validation", WithValidation(m))
+
+	if err := a.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+	if err := a.AddPolicy("g", "g", []string{"alice", "data2_admin"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	invalid := []struct {
+		ptype string
+		rule  []string
+	}{
+		{"p", []string{"alice", "data1"}},
+		{"p", []string{"alice", "data1", "read", "allow"}},
+		{"g", []string{"alice"}},
+		{"g2", []string{"alice", "data2_admin"}},
+	}
+	for _, tc := range invalid {
+		if err := a.AddPolicy(tc.ptype[:1], tc.ptype, tc.rule); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("Expected AddPolicy(%q, %v) to fail with ErrInvalidRule; got %v", tc.ptype, tc.rule, err)
+		}
+	}
+	if err := a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1"}); !errors.Is(err, ErrInvalidRule) {
+		t.Errorf("Expected UpdatePolicy() to fail with ErrInvalidRule; got %v", err)
+	}
+
+	e := newEnforcer(t, "examples/rbac_model.conf", a)
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}})
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+// verifyLines reads the rules matching the selector back and checks that
+// they are exactly lines, see WithVerifyAfterSave.
+func (a *Adapter) verifyLines(ctx context.Context, selector interface{}, lines []CasbinRule) error {
+	// Rules are compared by hash, counting duplicates.
+	missing := make(map[string]int, len(lines))
+	for _, line := range lines {
+		missing[ruleHash(line.PType, line.toStringPolicy())]++
+	}
+
+	unexpected := 0
+	stored, err := a.forEachLine(ctx, a.collection, selector, func(line CasbinRule) error {
+		h := ruleHash(line.PType, line.toStringPolicy())
+		if missing[h] == 0 {
+			unexpected++
+			return nil
+		}
+		missing[h]--
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	absent := 0
+	for _, n := range missing {
+		absent += n
+	}
+	a.debug("verified saved rules", "collection", a.collectionName, "count", stored, "missing", absent, "unexpected", unexpected)
+	if absent > 0 || unexpected > 0 {
+		return &wrappedError{
+			sentinel: ErrSaveMismatch,
+			err:      errors.New(strconv.Itoa(absent) + " rules missing, " + strconv.Itoa(unexpected) + " unexpected"),
+		}
+	}
+	return nil
+}
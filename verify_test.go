@@ -0,0 +1,57 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// losingHooks deletes a saved rule behind the adapter's back, as a cluster
+// losing an acknowledged write would.
+type losingHooks struct {
+	adapter *Adapter
+}
+
+func (h *losingHooks) BeforeChange(ctx context.Context, change *AuditEntry) error {
+	return nil
+}
+
+func (h *losingHooks) AfterChange(ctx context.Context, change *AuditEntry, err error) {
+	_, _ = h.adapter.collection.DeleteOne(ctx, bson.M{"v0": "bob"})
+}
+
+func TestAdapterWithVerifyAfterSave(t *testing.T) {
+	a := newTestAdapter(t, "casbin_rule_verify", WithVerifyAfterSave())
+
+	e := newEnforcer(t, "examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetAdapter(a)
+	if err := e.SavePolicy(); err != nil {
+		t.Fatalf("Expected SavePolicy() to be successful; got %v", err)
+	}
+
+	hooks := &losingHooks{}
+	lossy := newTestAdapter(t, "casbin_rule_verify", WithVerifyAfterSave(), WithHooks(hooks))
+	defer lossy.Close()
+	hooks.adapter = lossy
+
+	e.SetAdapter(lossy)
+	if err := e.SavePolicy(); !errors.Is(err, ErrSaveMismatch) {
+		t.Errorf("Expected SavePolicy() to fail with ErrSaveMismatch; got %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// watchBackoff is the delay before the first attempt to open a change stream
+// again after a transient error.
+const watchBackoff = 100 * time.Millisecond
+
+// Watcher notifies an enforcer when the policy stored by an Adapter changes.
+// It tails the policy collection with a MongoDB change stream, so it also
+// sees changes made by other processes. Change streams require a replica set
+// or a sharded cluster.
+type Watcher struct {
+	adapter    *Adapter
+	collection *mongo.Collection
+	stream     *mongo.ChangeStream
+	cancel     context.CancelFunc
+	cache      *policyCache
+
+	mu       sync.Mutex
+	callback func(string)
+	err      error
+
+	// events holds at most one pending notification, so a burst of changes
+	// (such as a SavePolicy) results in a single callback.
+	events chan string
+	done   chan struct{}
+}
+
+var _ persist.WatcherEx = (*Watcher)(nil)
+
+// NewWatcher is the constructor for Watcher. It starts watching the
+// collection used by the adapter, and invalidates the adapter's cache, if
+// any, on every change. It fails with ErrChangeStreamsUnsupported if the
+// server does not support change streams; the enforcer then has to reload
+// the policy by other means.
+//
+// For an adapter started from its snapshot file, see WithSnapshotFile, the
+// watcher waits for the server to become reachable, then starts watching and
+// calls the callback with "reconnect", so the enforcer reloads the policy.
+func NewWatcher(a *Adapter) (*Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &Watcher{
+		adapter: a,
+		cancel:  cancel,
+		cache:   a.cache,
+		events:  make(chan string, 1),
+		done:    make(chan struct{}),
+	}
+
+	if a.offline() {
+		go w.watchOnline(ctx, a.online)
+	} else {
+		collection := a.current()
+		stream, err := collection.Watch(ctx, mongo.Pipeline{})
+		if err != nil {
+			cancel()
+			return nil, changeStreamError(err)
+		}
+		w.collection, w.stream = collection, stream
+		go w.watch(ctx)
+	}
+	go w.dispatch()
+
+	return w, nil
+}
+
+// watchOnline waits until the adapter reaches the server, then opens the
+// change stream and watches it.
+func (w *Watcher) watchOnline(ctx context.Context, online chan struct{}) {
+	select {
+	case <-online:
+	case <-ctx.Done():
+		close(w.events)
+		return
+	}
+
+	if err := w.open(ctx, w.adapter.current(), nil); err != nil {
+		w.stop(ctx, err)
+		close(w.events)
+		return
+	}
+	// Changes made while the server was unreachable were missed.
+	w.notify("reconnect")
+	w.watch(ctx)
+}
+
+// watch reads the change stream until the watcher is closed. Dropping or
+// renaming over the collection, as SavePolicy does, invalidates the stream; a
+// new one is opened on the replaced collection. When the adapter moved to a
+// new client or collection, see RefreshCredentials and SwitchCollection, the
+// stream is opened anew there, and the callback is called with "reconnect" as
+// changes may have been missed in between. A stream that fails, for example
+// when the primary steps down, is resumed where it stopped.
+func (w *Watcher) watch(ctx context.Context) {
+	defer close(w.events)
+
+	for {
+		invalidated, err := w.consume(ctx)
+		token := w.stream.ResumeToken()
+		w.stream.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		collection := w.adapter.current()
+		reconnected := collection != w.collection
+		if invalidated || reconnected {
+			token = nil
+		} else if err != nil {
+			w.adapter.debug("change stream failed", "collection", collection.Name(), "error", err)
+		}
+
+		if err := w.open(ctx, collection, token); err != nil {
+			w.stop(ctx, err)
+			return
+		}
+		if reconnected {
+			w.notify("reconnect")
+		}
+	}
+}
+
+// open opens a change stream on the collection, resuming after token unless
+// it is nil. Transient errors are retried until the watcher is closed, waiting
+// twice as long before each attempt. If the stream cannot be resumed, for
+// example because the oplog no longer holds the token, a new one is opened
+// and the callback is called with "reconnect".
+func (w *Watcher) open(ctx context.Context, collection *mongo.Collection, token bson.Raw) error {
+	backoff, lost := watchBackoff, false
+	for {
+		opts := options.ChangeStream()
+		if token != nil {
+			opts.SetResumeAfter(token)
+		}
+		stream, err := collection.Watch(ctx, mongo.Pipeline{}, opts)
+		switch {
+		case err == nil:
+			w.collection, w.stream = collection, stream
+			if lost {
+				w.notify("reconnect")
+			}
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case token != nil && !isTransient(err):
+			w.adapter.debug("cannot resume change stream", "collection", collection.Name(), "error", err)
+			token, lost = nil, true
+			continue
+		case !isTransient(err):
+			return err
+		}
+
+		w.adapter.debug("retrying change stream", "collection", collection.Name(), "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// stop records the error that stopped the watcher, unless it was closed.
+func (w *Watcher) stop(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	w.adapter.debug("watcher stopped", "error", err)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// Err returns the error that stopped the watcher, such as missing privileges
+// to open a change stream, or nil while it is running or after Close. The
+// callback is not called anymore once the watcher stopped; the enforcer has
+// to reload the policy by other means.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// notify queues a notification, unless one is pending already.
+func (w *Watcher) notify(msg string) {
+	// Invalidate before the callback reloads the policy.
+	if w.cache != nil {
+		w.cache.invalidate()
+	}
+
+	select {
+	case w.events <- msg:
+	default:
+		// A notification is already pending.
+	}
+}
+
+// consume forwards the events of the current stream and reports whether the
+// stream ended because it was invalidated, or the error it failed with.
+func (w *Watcher) consume(ctx context.Context) (bool, error) {
+	for w.stream.Next(ctx) {
+		var event struct {
+			OperationType string `bson:"operationType"`
+		}
+		if err := w.stream.Decode(&event); err != nil {
+			w.adapter.debug("cannot decode change event", "collection", w.collection.Name(), "error", err)
+			continue
+		}
+
+		w.notify(event.OperationType)
+
+		if event.OperationType == "invalidate" {
+			return true, nil
+		}
+	}
+	return false, w.stream.Err()
+}
+
+// dispatch delivers pending notifications to the callback.
+func (w *Watcher) dispatch() {
+	defer close(w.done)
+
+	for msg := range w.events {
+		w.mu.Lock()
+		callback := w.callback
+		w.mu.Unlock()
+
+		if callback != nil {
+			callback(msg)
+		}
+	}
+}
+
+// SetUpdateCallback sets the callback function that the watcher will call
+// when the policy in the database has been changed. The message is the
+// change stream operation type, such as "insert" or "delete".
+func (w *Watcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.callback = callback
+	return nil
+}
+
+// Update is called by the enforcer after it changed the policy. The change
+// stream already reports every write, so there is nothing to publish.
+func (w *Watcher) Update() error {
+	return nil
+}
+
+// UpdateForAddPolicy is called after a policy rule has been added.
+func (w *Watcher) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.Update()
+}
+
+// UpdateForRemovePolicy is called after a policy rule has been removed.
+func (w *Watcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.Update()
+}
+
+// UpdateForRemoveFilteredPolicy is called after policy rules matching a
+// filter have been removed.
+func (w *Watcher) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.Update()
+}
+
+// UpdateForSavePolicy is called after the whole policy has been saved.
+func (w *Watcher) UpdateForSavePolicy(model model.Model) error {
+	return w.Update()
+}
+
+// UpdateForAddPolicies is called after policy rules have been added.
+func (w *Watcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.Update()
+}
+
+// UpdateForRemovePolicies is called after policy rules have been removed.
+func (w *Watcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.Update()
+}
+
+// Close stops the watcher and waits until the last callback has returned.
+func (w *Watcher) Close() {
+	w.cancel()
+	<-w.done
+}
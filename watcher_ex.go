@@ -0,0 +1,410 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// updateRetention is how long published updates are kept; only watchers that
+// are running when an update is published receive it.
+const updateRetention = time.Hour
+
+// PolicyUpdate describes a change of the policy published by a WatcherEx.
+type PolicyUpdate struct {
+	// Method is the method of the watcher that published the update, such
+	// as "UpdateForAddPolicy", or "Update" for a change without details.
+	Method string `bson:"method"`
+	Sec    string `bson:"sec,omitempty"`
+	PType  string `bson:"ptype,omitempty"`
+	// Rules are the rules added or removed.
+	Rules [][]string `bson:"rules,omitempty"`
+	// FieldIndex and FieldValues describe the filter of
+	// UpdateForRemoveFilteredPolicy.
+	FieldIndex  int      `bson:"field_index,omitempty"`
+	FieldValues []string `bson:"field_values,omitempty"`
+}
+
+// updateDoc is the document stored for each published update.
+type updateDoc struct {
+	Origin       string    `bson:"origin"`
+	Time         time.Time `bson:"time"`
+	Tenant       string    `bson:"tenant,omitempty"`
+	PolicyUpdate `bson:",inline"`
+}
+
+// WatcherEx notifies enforcers of other processes of changes to the policy,
+// along with the changed rules, so they can apply the changes without
+// reloading the whole policy. Unlike Watcher, it does not observe the policy
+// collection: each process publishes its changes by calling the UpdateFor
+// methods, as enforcers supporting watchers with rule-level updates do. The
+// updates are passed through a collection named after the policy collection
+// with an "_updates" suffix, which is tailed with a change stream; change
+// streams require a replica set or a sharded cluster. The watcher of a
+// tenant-scoped adapter only publishes and receives the updates of its
+// tenant, see WithTenant.
+type WatcherEx struct {
+	adapter  *Adapter
+	id       string
+	tenant   string
+	updates  *mongo.Collection
+	pipeline mongo.Pipeline
+	stream   *mongo.ChangeStream
+	cancel   context.CancelFunc
+	cache    *policyCache
+
+	mu             sync.Mutex
+	callback       func(string)
+	updateCallback func(PolicyUpdate)
+	err            error
+
+	events chan PolicyUpdate
+	done   chan struct{}
+}
+
+var _ persist.WatcherEx = (*WatcherEx)(nil)
+
+// NewWatcherEx is the constructor for WatcherEx. It starts receiving the
+// updates published by other processes for the adapter's collection, and
+// invalidates the adapter's cache, if any, on each.
+func NewWatcherEx(a *Adapter) (*WatcherEx, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db := a.collection.Database()
+	updates := db.Collection(a.collectionName+"_updates", a.collectionOptions())
+	_, err := updates.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "time", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(updateRetention / time.Second)),
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	w := &WatcherEx{
+		adapter: a,
+		id:      primitive.NewObjectID().Hex(),
+		tenant:  a.tenant,
+		updates: updates,
+		cancel:  cancel,
+		cache:   a.cache,
+		events:  make(chan PolicyUpdate, 64),
+		done:    make(chan struct{}),
+	}
+
+	match := bson.M{
+		"operationType":       "insert",
+		"fullDocument.origin": bson.M{"$ne": w.id},
+	}
+	if w.tenant != "" {
+		match["fullDocument.tenant"] = w.tenant
+	}
+	w.pipeline = mongo.Pipeline{{{Key: "$match", Value: match}}}
+	w.stream, err = updates.Watch(ctx, w.pipeline)
+	if err != nil {
+		cancel()
+		return nil, changeStreamError(err)
+	}
+
+	go w.watch(ctx)
+	go w.dispatch()
+
+	return w, nil
+}
+
+// watch forwards the updates of other processes until the watcher is
+// closed. A stream that fails, for example when the primary steps down, is
+// resumed where it stopped. If it cannot be resumed, a new one is opened and
+// an "Update" is delivered, as updates may have been missed in between.
+func (w *WatcherEx) watch(ctx context.Context) {
+	defer close(w.events)
+
+	for {
+		err := w.consume(ctx)
+		token := w.stream.ResumeToken()
+		w.stream.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			// The stream was invalidated, as by dropping the collection,
+			// and cannot be resumed.
+			token = nil
+		} else {
+			w.adapter.debug("change stream failed", "collection", w.updates.Name(), "error", err)
+		}
+
+		if err := w.open(ctx, token); err != nil {
+			w.stop(ctx, err)
+			return
+		}
+		if token == nil && !w.deliver(ctx, PolicyUpdate{Method: "Update"}) {
+			return
+		}
+	}
+}
+
+// open opens the change stream, resuming after token unless it is nil.
+// Transient errors are retried with exponential backoff until ctx is done;
+// a stream that cannot be resumed is opened anew and an "Update" delivered.
+func (w *WatcherEx) open(ctx context.Context, token bson.Raw) error {
+	backoff, lost := watchBackoff, false
+	for {
+		opts := options.ChangeStream()
+		if token != nil {
+			opts.SetResumeAfter(token)
+		}
+		stream, err := w.updates.Watch(ctx, w.pipeline, opts)
+		switch {
+		case err == nil:
+			w.stream = stream
+			if lost && !w.deliver(ctx, PolicyUpdate{Method: "Update"}) {
+				return ctx.Err()
+			}
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case token != nil && !isTransient(err):
+			w.adapter.debug("cannot resume change stream", "collection", w.updates.Name(), "error", err)
+			token, lost = nil, true
+			continue
+		case !isTransient(err):
+			return err
+		}
+
+		w.adapter.debug("retrying change stream", "collection", w.updates.Name(), "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// consume forwards the updates of the current stream and returns the error
+// it failed with, or nil if it was invalidated or the watcher closed.
+func (w *WatcherEx) consume(ctx context.Context) error {
+	for w.stream.Next(ctx) {
+		var event struct {
+			Doc updateDoc `bson:"fullDocument"`
+		}
+		if err := w.stream.Decode(&event); err != nil {
+			w.adapter.debug("cannot decode update", "collection", w.updates.Name(), "error", err)
+			continue
+		}
+
+		update := event.Doc.PolicyUpdate
+		if w.tenant == "" && event.Doc.Tenant != "" {
+			// The rules of a tenant cannot be told apart from equal rules
+			// of other tenants in the policy of all tenants.
+			update = PolicyUpdate{Method: "Update"}
+		}
+		if !w.deliver(ctx, update) {
+			return nil
+		}
+	}
+	return w.stream.Err()
+}
+
+// deliver queues an update for the callbacks and reports whether it was
+// queued before the watcher was closed.
+func (w *WatcherEx) deliver(ctx context.Context, update PolicyUpdate) bool {
+	// Invalidate before the callback updates the policy.
+	if w.cache != nil {
+		w.cache.invalidate()
+	}
+
+	select {
+	case w.events <- update:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stop records the error that stopped the watcher, unless it was closed.
+func (w *WatcherEx) stop(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	w.adapter.debug("watcher stopped", "error", err)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// Err returns the error that stopped the watcher, such as missing privileges
+// to open a change stream, or nil while it is running or after Close. No
+// updates are delivered anymore once the watcher stopped; the enforcer has
+// to reload the policy by other means.
+func (w *WatcherEx) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// dispatch delivers the updates to the callbacks, in the order they were
+// received.
+func (w *WatcherEx) dispatch() {
+	defer close(w.done)
+
+	for update := range w.events {
+		w.mu.Lock()
+		callback, updateCallback := w.callback, w.updateCallback
+		w.mu.Unlock()
+
+		if updateCallback != nil {
+			updateCallback(update)
+		} else if callback != nil {
+			callback(update.Method)
+		}
+	}
+}
+
+// SetUpdateCallback sets the callback function that the watcher will call
+// when another process has changed the policy. The message is the method
+// that published the change, such as "UpdateForAddPolicy". It is not called
+// while a callback set with SetPolicyUpdateCallback is in place.
+func (w *WatcherEx) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.callback = callback
+	return nil
+}
+
+// SetPolicyUpdateCallback sets the callback function that the watcher will
+// call with each change another process has made to the policy, for example
+// to apply it to the model of the enforcer. An update with the method
+// "Update" or "UpdateForSavePolicy" carries no rules and requires a reload.
+func (w *WatcherEx) SetPolicyUpdateCallback(callback func(PolicyUpdate)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.updateCallback = callback
+	return nil
+}
+
+// publish stores an update for the other processes.
+func (w *WatcherEx) publish(update PolicyUpdate) error {
+	_, err := w.updates.InsertOne(context.Background(), updateDoc{
+		Origin:       w.id,
+		Time:         time.Now(),
+		Tenant:       w.tenant,
+		PolicyUpdate: update,
+	})
+	return err
+}
+
+// Update is called by the enforcer after it changed the policy in a way the
+// other methods do not describe. The other processes must reload the policy.
+func (w *WatcherEx) Update() error {
+	return w.publish(PolicyUpdate{Method: "Update"})
+}
+
+// UpdateForAddPolicy is called after a policy rule has been added.
+func (w *WatcherEx) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	return w.publish(PolicyUpdate{Method: "UpdateForAddPolicy", Sec: sec, PType: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemovePolicy is called after a policy rule has been removed.
+func (w *WatcherEx) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	return w.publish(PolicyUpdate{Method: "UpdateForRemovePolicy", Sec: sec, PType: ptype, Rules: [][]string{params}})
+}
+
+// UpdateForRemoveFilteredPolicy is called after policy rules matching a
+// filter have been removed.
+func (w *WatcherEx) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	return w.publish(PolicyUpdate{
+		Method:      "UpdateForRemoveFilteredPolicy",
+		Sec:         sec,
+		PType:       ptype,
+		FieldIndex:  fieldIndex,
+		FieldValues: fieldValues,
+	})
+}
+
+// UpdateForSavePolicy is called after the whole policy has been saved. The
+// other processes must reload the policy.
+func (w *WatcherEx) UpdateForSavePolicy(model model.Model) error {
+	return w.publish(PolicyUpdate{Method: "UpdateForSavePolicy"})
+}
+
+// UpdateForAddPolicies is called after policy rules have been added.
+func (w *WatcherEx) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(PolicyUpdate{Method: "UpdateForAddPolicies", Sec: sec, PType: ptype, Rules: rules})
+}
+
+// UpdateForRemovePolicies is called after policy rules have been removed.
+func (w *WatcherEx) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	return w.publish(PolicyUpdate{Method: "UpdateForRemovePolicies", Sec: sec, PType: ptype, Rules: rules})
+}
+
+// Close stops the watcher and waits until the last callback has returned.
+func (w *WatcherEx) Close() {
+	w.cancel()
+	<-w.done
+}
+
+// Apply applies the update to the model, and reports whether the policy must
+// be reloaded instead because the update carries no rules, concerns a policy
+// type the model does not define, or cannot be applied. Grouping policy
+// changes require the role links to be rebuilt, for example with the
+// enforcer's BuildRoleLinks.
+func (u PolicyUpdate) Apply(model model.Model) (reload bool) {
+	if _, ok := model[u.Sec][u.PType]; !ok {
+		return true
+	}
+
+	var err error
+	switch u.Method {
+	case "UpdateForAddPolicy", "UpdateForAddPolicies":
+		for _, rule := range u.Rules {
+			var found bool
+			if found, err = model.HasPolicy(u.Sec, u.PType, rule); err == nil && !found {
+				err = model.AddPolicy(u.Sec, u.PType, rule)
+			}
+			if err != nil {
+				break
+			}
+		}
+	case "UpdateForRemovePolicy", "UpdateForRemovePolicies":
+		for _, rule := range u.Rules {
+			if _, err = model.RemovePolicy(u.Sec, u.PType, rule); err != nil {
+				break
+			}
+		}
+	case "UpdateForRemoveFilteredPolicy":
+		_, _, err = model.RemoveFilteredPolicy(u.Sec, u.PType, u.FieldIndex, u.FieldValues...)
+	default:
+		return true
+	}
+	return err != nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodbadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	a := newTestAdapter(t, defaultCollectionName)
+
+	w, err := NewWatcher(a)
+	if err != nil {
+		// Change streams are only available on replica sets.
+		t.Skipf("Change streams are not supported by the test server: %v", err)
+	}
+	defer w.Close()
+
+	updates := make(chan string, 10)
+	if err := w.SetUpdateCallback(func(msg string) { updates <- msg }); err != nil {
+		t.Errorf("Expected SetUpdateCallback() to be successful; got %v", err)
+	}
+
+	// A change made through another adapter must reach the callback.
+	other := NewAdapter(getDbURL())
+	if err := other.AddPolicy("p", "p", []string{"alice", "data1", "read"}); err != nil {
+		t.Errorf("Expected AddPolicy() to be successful; got %v", err)
+	}
+
+	select {
+	case msg := <-updates:
+		if msg != "insert" {
+			t.Errorf("Expected an insert notification; got %s", msg)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Expected the watcher to report the change")
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("Expected the watcher to be running; got %v", err)
+	}
+}
+
+func TestWatcherEx(t *testing.T) {
+	a, err := NewAdapterWithError(getDbURL())
+	if err != nil {
+		t.Fatalf("Expected NewAdapterWithError() to be successful; got %v", err)
+	}
+
+	publisher, err := NewWatcherEx(a)
+	if err != nil {
+		// Change streams are only available on replica sets.
+		t.Skipf("Change streams are not supported by the test server: %v", err)
+	}
+	defer publisher.updates.Drop(context.Background())
+	defer publisher.Close()
+
+	subscriber, err := NewWatcherEx(a)
+	if err != nil {
+		t.Fatalf("Expected NewWatcherEx() to be successful; got %v", err)
+	}
+	defer subscriber.Close()
+
+	tenant, err := NewWatcherEx(a.WithTenant("acme"))
+	if err != nil {
+		t.Fatalf("Expected NewWatcherEx() to be successful; got %v", err)
+	}
+	defer tenant.Close()
+
+	own := make(chan PolicyUpdate, 10)
+	publisher.SetPolicyUpdateCallback(func(u PolicyUpdate) { own <- u })
+	received := make(chan PolicyUpdate, 10)
+	subscriber.SetPolicyUpdateCallback(func(u PolicyUpdate) { received <- u })
+	other := make(chan PolicyUpdate, 10)
+	tenant.SetPolicyUpdateCallback(func(u PolicyUpdate) { other <- u })
+
+	if err := publisher.UpdateForAddPolicy("p", "p", "alice", "data1", "read"); err != nil {
+		t.Errorf("Expected UpdateForAddPolicy() to be successful; got %v", err)
+	}
+
+	select {
+	case u := <-received:
+		if u.Method != "UpdateForAddPolicy" || u.PType != "p" || len(u.Rules) != 1 || u.Rules[0][0] != "alice" {
+			t.Errorf("Unexpected update: %+v", u)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Expected the subscriber to receive the update")
+	}
+
+	select {
+	case u := <-own:
+		t.Errorf("Expected the publisher not to receive its own update; got %+v", u)
+	case u := <-other:
+		t.Errorf("Expected a tenant not to receive the update of another tenant; got %+v", u)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// Dropping the updates invalidates the streams; the watchers open new
+	// ones and ask for a reload, as updates may have been missed.
+	if err := publisher.updates.Drop(context.Background()); err != nil {
+		t.Fatalf("Expected Drop() to be successful; got %v", err)
+	}
+	select {
+	case u := <-received:
+		if u.Method != "Update" {
+			t.Errorf("Expected an Update after the stream was invalidated; got %+v", u)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Expected the subscriber to ask for a reload")
+	}
+	if err := publisher.UpdateForRemovePolicy("p", "p", "alice", "data1", "read"); err != nil {
+		t.Errorf("Expected UpdateForRemovePolicy() to be successful; got %v", err)
+	}
+	select {
+	case u := <-received:
+		if u.Method != "UpdateForRemovePolicy" {
+			t.Errorf("Unexpected update: %+v", u)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Expected the subscriber to receive updates on the new stream")
+	}
+	if err := subscriber.Err(); err != nil {
+		t.Errorf("Expected the watcher to be running; got %v", err)
+	}
+}